@@ -0,0 +1,85 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/iychoi/parcel/pkg/catalog"
+)
+
+const (
+	defaultServeAddress = "127.0.0.1:8080"
+)
+
+func catalogHandler(ctx context.Context, args []string) {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: catalog <subcommand> [options]\n")
+		fmt.Fprintf(os.Stderr, "Subcommands:\n")
+		fmt.Fprintf(os.Stderr, "  serve    serve datasets of local files over the catalog service API\n")
+	}
+
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "serve":
+		catalogServeHandler(ctx, args[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func catalogServeHandler(ctx context.Context, args []string) {
+	var from string
+	var address string
+
+	flagset := flag.NewFlagSet("catalog serve", flag.ExitOnError)
+	flagset.StringVar(&from, "from", "", "Set a JSON or YAML file, or a directory of them, holding datasets")
+	flagset.StringVar(&address, "listen", defaultServeAddress, "Set an address to listen on")
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: catalog serve -from <file|dir> [options]\n")
+		flagset.PrintDefaults()
+	}
+	parseFlags(flagset, args)
+
+	if len(from) == 0 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	fileCatalog, err := catalog.NewFileCatalog(from)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	datasets, err := fileCatalog.GetAllDatasets(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Serving %d datasets of %s at http://%s", len(datasets), from, address)
+	server := catalog.NewCatalogServer(fileCatalog, trace)
+	err = server.ListenAndServe(ctx, address)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
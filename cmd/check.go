@@ -0,0 +1,101 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"github.com/iychoi/parcel/pkg/catalog"
+	"github.com/iychoi/parcel/pkg/probe"
+)
+
+const (
+	// probeWorkers is the max number of datasets probed concurrently
+	probeWorkers = 8
+)
+
+func checkHandler(ctx context.Context, args []string) {
+	flagset := flag.NewFlagSet("check", flag.ExitOnError)
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: check <id|name|pattern>...\n")
+		fmt.Fprintf(flagset.Output(), "  Checks that URLs of datasets are reachable. Datasets are selected as in order.\n")
+		flagset.PrintDefaults()
+	}
+	selectors := parseFlags(flagset, args)
+
+	if len(selectors) == 0 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	client, err := newCatalog()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	datasets := resolveDatasets(ctx, client, selectors, nil)
+	results := probeDatasets(ctx, datasets)
+
+	failed := 0
+	for idx, ds := range datasets {
+		fmt.Printf("[%s] %s\n", catalog.GetDatasetRef(ds), ds.Name)
+		fmt.Printf("  URL         : %s\n", ds.URL)
+		fmt.Printf("  Status      : %s\n", results[idx])
+
+		if !results[idx].OK() {
+			failed++
+		}
+	}
+
+	if ctx.Err() != nil {
+		exitWithError(ctx.Err())
+	}
+
+	if failed > 0 {
+		log.Printf("%d of %d datasets are unreachable\n", failed, len(datasets))
+		os.Exit(exitCodeUnreachable)
+	}
+}
+
+// probeDatasets probes URLs of datasets concurrently, results are in the order of datasets
+// At most probeWorkers datasets are probed at a time.
+func probeDatasets(ctx context.Context, datasets []*dataset.Dataset) []*probe.Result {
+	results := make([]*probe.Result, len(datasets))
+
+	idxChan := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < probeWorkers && i < len(datasets); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for idx := range idxChan {
+				results[idx] = probe.Probe(ctx, datasets[idx].URL, timeout)
+			}
+		}()
+	}
+
+	for idx := range datasets {
+		idxChan <- idx
+	}
+	close(idxChan)
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"github.com/iychoi/parcel/pkg/catalog"
+	"github.com/iychoi/parcel/pkg/citation"
+	"github.com/iychoi/parcel/pkg/kubernetes"
+)
+
+func citeHandler(ctx context.Context, args []string) {
+	var format string
+	var ordered bool
+
+	flagset := flag.NewFlagSet("cite", flag.ExitOnError)
+	flagset.StringVar(&format, "format", citation.FormatBibTeX, fmt.Sprintf("Set a citation format (%s, %s, %s)", citation.FormatBibTeX, citation.FormatRIS, citation.FormatCSLJSON))
+	flagset.BoolVar(&ordered, "ordered", false, "Cite datasets ordered in the namespace")
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: cite [options] <id|name|pattern>...\n")
+		fmt.Fprintf(flagset.Output(), "       cite [options] -ordered\n")
+		flagset.PrintDefaults()
+	}
+	selectors := parseFlags(flagset, args)
+
+	if len(selectors) == 0 && !ordered {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	err := citation.ValidateFormat(format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	client, err := newCatalog()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	failed := 0
+	datasets := []*dataset.Dataset{}
+	if len(selectors) > 0 {
+		datasets = resolveDatasets(ctx, client, selectors, nil)
+	}
+
+	if ordered {
+		volumeManager, err := kubernetes.NewVolumeManager(config.KubernetesConfigPath, config.Namespace)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		mounts, err := volumeManager.ListVolumes()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// volumes only keep dataset ids, metadata is read from the catalog
+		// datasets that cannot be read, e.g. retracted ones, are skipped
+		for _, mount := range mounts {
+			ref := catalog.GetDatasetRef(mount.Dataset)
+			ds, err := client.GetDataset(ctx, ref)
+			if err != nil {
+				if ctx.Err() != nil {
+					exitWithError(ctx.Err())
+				}
+
+				log.Printf("Skipping ordered dataset [%s] of volume %s - %v\n", ref, mount.PersistentVolume.GetName(), err)
+				failed++
+				continue
+			}
+			datasets = append(datasets, ds)
+		}
+	}
+
+	accessed := time.Now()
+	citations := []*citation.Citation{}
+	cited := map[string]bool{}
+	for _, ds := range datasets {
+		ref := catalog.GetDatasetRef(ds)
+		if cited[ref] {
+			continue
+		}
+		cited[ref] = true
+
+		c, err := citation.NewCitation(ds, accessed)
+		if err != nil {
+			log.Printf("Skipping dataset [%s] - %v\n", ref, err)
+			failed++
+			continue
+		}
+		citations = append(citations, c)
+	}
+
+	output, err := citation.Format(citations, format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(output)
+
+	if failed > 0 {
+		log.Printf("%d datasets are not cited\n", failed)
+		os.Exit(exitCodeError)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iychoi/parcel/pkg/catalog"
+	"github.com/iychoi/parcel/pkg/webdav"
+)
+
+const (
+	progressInterval = 500 * time.Millisecond
+)
+
+func fetchHandler(ctx context.Context, args []string) {
+	var workers int
+
+	flagset := flag.NewFlagSet("fetch", flag.ExitOnError)
+	flagset.IntVar(&workers, "workers", webdav.DefaultFetchWorkers, "Set the number of files downloaded concurrently")
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: fetch [options] <id|name|pattern>... <dest>\n")
+		fmt.Fprintf(flagset.Output(), "  Datasets are selected as in order. Multiple datasets are fetched into subdirectories of dest named by their IDs.\n")
+		flagset.PrintDefaults()
+	}
+	positional := parseFlags(flagset, args)
+
+	if len(positional) < 2 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	selectors := positional[:len(positional)-1]
+	dest := positional[len(positional)-1]
+
+	client, err := newCatalog()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	datasets := resolveDatasets(ctx, client, selectors, nil)
+
+	for _, ds := range datasets {
+		davClient, err := newWebDAVClient(ds)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		localDir := dest
+		if len(datasets) > 1 {
+			localDir = filepath.Join(dest, strings.ReplaceAll(catalog.GetDatasetRef(ds), "/", "-"))
+		}
+
+		log.Printf("Fetching [%s] %s to %s...\n", catalog.GetDatasetRef(ds), ds.Name, localDir)
+
+		progress := webdav.FetchProgress{}
+		done := make(chan struct{})
+		reported := make(chan struct{})
+		go func() {
+			reportFetchProgress(&progress, done)
+			close(reported)
+		}()
+
+		err = davClient.Fetch(ctx, "/", localDir, &webdav.FetchOptions{
+			Workers: workers,
+		}, &progress)
+		close(done)
+		<-reported
+
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+}
+
+// reportFetchProgress prints progress periodically until done is closed
+func reportFetchProgress(progress *webdav.FetchProgress, done chan struct{}) {
+	terminal := isTerminal(os.Stderr)
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			printFetchProgress(progress.Snapshot(), terminal)
+			if terminal {
+				fmt.Fprintf(os.Stderr, "\n")
+			}
+			return
+		case <-ticker.C:
+			// rewrite the line on a terminal only, not to flood logs
+			if terminal {
+				printFetchProgress(progress.Snapshot(), terminal)
+			}
+		}
+	}
+}
+
+func printFetchProgress(progress webdav.FetchProgress, terminal bool) {
+	percent := 100.0
+	if progress.TotalBytes > 0 {
+		percent = float64(progress.DoneBytes) * 100 / float64(progress.TotalBytes)
+	}
+
+	line := fmt.Sprintf("%d/%d files (%d skipped, %d failed), %s/%s (%.0f%%)",
+		progress.DoneFiles+progress.FailedFiles, progress.TotalFiles, progress.SkippedFiles, progress.FailedFiles,
+		formatBytes(progress.DoneBytes), formatBytes(progress.TotalBytes), percent)
+
+	if terminal {
+		fmt.Fprintf(os.Stderr, "\r%-80s", line)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s\n", line)
+	}
+}
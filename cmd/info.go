@@ -0,0 +1,115 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+
+	"github.com/iychoi/parcel/pkg/catalog"
+	"github.com/iychoi/parcel/pkg/kubernetes"
+)
+
+func infoHandler(ctx context.Context, args []string) {
+	flagset := flag.NewFlagSet("info", flag.ExitOnError)
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: info <id>...\n")
+		flagset.PrintDefaults()
+	}
+	flagset.Parse(args)
+
+	if flagset.NArg() == 0 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	client, err := newCatalog()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// orders are optional, show dataset details without kubernetes
+	volumeManager, err := kubernetes.NewVolumeManager(config.KubernetesConfigPath, config.Namespace)
+	if err != nil {
+		log.Printf("Orders are not shown - %v", err)
+		volumeManager = nil
+	}
+
+	for idx, id := range flagset.Args() {
+		ds, err := client.GetDataset(ctx, id)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if idx > 0 {
+			fmt.Printf("\n")
+		}
+
+		scheme := ""
+		u, err := url.Parse(ds.URL)
+		if err == nil {
+			scheme = u.Scheme
+		}
+
+		clientType, err := kubernetes.GetClientType(ds)
+		if err != nil {
+			clientType = fmt.Sprintf("not supported (%v)", err)
+		}
+
+		fmt.Printf("[%s] %s\n", catalog.GetDatasetRef(ds), ds.Name)
+		fmt.Printf("  Name        : %s\n", ds.Name)
+		fmt.Printf("  Creator     : %s\n", ds.Creator)
+		fmt.Printf("  Host        : %s\n", ds.Host)
+		fmt.Printf("  Rights      : %s\n", ds.Rights)
+		fmt.Printf("  URL         : %s\n", ds.URL)
+		fmt.Printf("  Scheme      : %s\n", scheme)
+		fmt.Printf("  Client      : %s\n", clientType)
+
+		keys := []string{}
+		for k := range ds.Tags {
+			// the source catalog is shown in the ref
+			if k != catalog.SourceCatalogTag {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			fmt.Printf("  %-12s: %s\n", k, ds.Tags[k])
+		}
+
+		fmt.Printf("  Description :\n%s\n", ds.Description)
+
+		if volumeManager == nil {
+			continue
+		}
+
+		mounts, err := volumeManager.ListDatasetVolumes(ds)
+		if err != nil {
+			log.Printf("Could not list orders - %v", err)
+			continue
+		}
+
+		fmt.Printf("  Orders in namespace %s: %d\n", config.Namespace, len(mounts))
+		for _, mount := range mounts {
+			fmt.Printf("    VolumeName: %s (%s)\n", mount.PersistentVolume.GetName(), mount.PersistentVolume.Status.Phase)
+			fmt.Printf("      ClaimName: %s (%s)\n", mount.PersistentVolumeClaim.GetName(), mount.PersistentVolumeClaim.Status.Phase)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/iychoi/parcel/pkg/auth"
+)
+
+const (
+	defaultAuthScopes = "openid offline_access"
+)
+
+var (
+	// errNoCredentials is returned when credentials required for a catalog are not stored
+	errNoCredentials = errors.New("credentials are required")
+)
+
+func loadCredentialStore() (*auth.CredentialStore, error) {
+	credentialsPath, err := auth.GetDefaultCredentialsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.LoadCredentialStore(credentialsPath)
+}
+
+func loginHandler(ctx context.Context, args []string) {
+	var token string
+	var issuer string
+	var clientID string
+	var scopes string
+	var catalogName string
+
+	flagset := flag.NewFlagSet("login", flag.ExitOnError)
+	flagset.StringVar(&token, "token", "", "Set an access token, prompted if neither a token nor an issuer is given")
+	flagset.StringVar(&issuer, "issuer", config.AuthIssuer, "Set an OAuth2 issuer URL to log in with a device code")
+	flagset.StringVar(&clientID, "client-id", config.AuthClientID, "Set an OAuth2 client ID for the device code login")
+	flagset.StringVar(&scopes, "scopes", defaultAuthScopes, "Set OAuth2 scopes for the device code login")
+	flagset.StringVar(&catalogName, "catalog", "", "Set a catalog name to log in to, if multiple catalogs are configured")
+	flagset.Parse(args)
+
+	catalogURL, err := getCatalogEndpointURL(catalogName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := loadCredentialStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var creds *auth.Credentials
+	if len(token) == 0 && len(issuer) > 0 {
+		creds, err = loginWithDeviceCode(ctx, issuer, clientID, strings.Fields(scopes))
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		if len(token) == 0 {
+			token, err = readToken()
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		creds = &auth.Credentials{
+			AccessToken: token,
+		}
+	}
+
+	creds.CatalogServiceURL = catalogURL
+	err = store.Set(creds)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Stored credentials for %s\n", catalogURL)
+}
+
+func loginWithDeviceCode(ctx context.Context, issuer string, clientID string, scopes []string) (*auth.Credentials, error) {
+	if len(clientID) == 0 {
+		return nil, fmt.Errorf("device code login requires a client ID (-client-id)")
+	}
+
+	flow := auth.NewDeviceFlow(issuer, clientID, scopes)
+	authorization, err := flow.Start(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(authorization.VerificationURIComplete) > 0 {
+		fmt.Printf("Open %s in a browser to log in\n", authorization.VerificationURIComplete)
+	} else {
+		fmt.Printf("Open %s in a browser and enter code %s to log in\n", authorization.VerificationURI, authorization.UserCode)
+	}
+
+	log.Printf("Waiting for the login to be approved...\n")
+	return flow.Wait(ctx, authorization)
+}
+
+func readToken() (string, error) {
+	fmt.Fprintf(os.Stderr, "Access token: ")
+
+	reader := bufio.NewReader(os.Stdin)
+	line, err := reader.ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return "", err
+	}
+
+	token := strings.TrimSpace(line)
+	if len(token) == 0 {
+		return "", fmt.Errorf("access token is empty")
+	}
+	return token, nil
+}
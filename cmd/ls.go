@@ -0,0 +1,113 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"github.com/iychoi/parcel/pkg/catalog"
+	"github.com/iychoi/parcel/pkg/kubernetes"
+	"github.com/iychoi/parcel/pkg/webdav"
+)
+
+func lsHandler(ctx context.Context, args []string) {
+	var recursive bool
+	var depth int
+
+	flagset := flag.NewFlagSet("ls", flag.ExitOnError)
+	flagset.BoolVar(&recursive, "r", false, "List collections recursively")
+	flagset.IntVar(&depth, "depth", 0, "Set a max depth of recursive listing, 0 for no limit")
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: ls [options] <id> [path]\n")
+		flagset.PrintDefaults()
+	}
+	positional := parseFlags(flagset, args)
+
+	if len(positional) == 0 || len(positional) > 2 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	entryPath := "/"
+	if len(positional) == 2 {
+		entryPath = positional[1]
+	}
+
+	client, err := newCatalog()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ds, err := client.GetDataset(ctx, positional[0])
+	if err != nil {
+		exitWithError(err)
+	}
+
+	davClient, err := newWebDAVClient(ds)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	printEntry := func(entry *webdav.Entry) error {
+		if entry.IsDir {
+			fmt.Printf("d %12s  %s  %s/\n", "-", formatModTime(entry), entry.Path)
+		} else {
+			fmt.Printf("- %12d  %s  %s\n", entry.Size, formatModTime(entry), entry.Path)
+		}
+		return nil
+	}
+
+	if recursive || depth > 0 {
+		err = davClient.Walk(ctx, entryPath, depth, printEntry)
+	} else {
+		var entries []*webdav.Entry
+		entries, err = davClient.List(ctx, entryPath)
+		for _, entry := range entries {
+			printEntry(entry)
+		}
+	}
+
+	if err != nil {
+		exitWithError(err)
+	}
+}
+
+// newWebDAVClient returns a WebDAV client for datasets mounted by the WebDAV client
+func newWebDAVClient(ds *dataset.Dataset) (*webdav.Client, error) {
+	clientType, err := kubernetes.GetClientType(ds)
+	if err != nil {
+		return nil, err
+	}
+
+	if clientType != kubernetes.ClientTypeWebDAV {
+		return nil, fmt.Errorf("dataset [%s] is served by %s, only WebDAV datasets can be browsed", catalog.GetDatasetRef(ds), clientType)
+	}
+
+	return webdav.NewClient(ds.URL, &webdav.ClientOptions{
+		Trace:   trace,
+		Timeout: timeout,
+	})
+}
+
+func formatModTime(entry *webdav.Entry) string {
+	if entry.ModTime.IsZero() {
+		return fmt.Sprintf("%-16s", "-")
+	}
+	return entry.ModTime.Local().Format("2006-01-02 15:04")
+}
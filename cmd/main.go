@@ -14,17 +14,42 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"github.com/iychoi/parcel/pkg/auth"
 	"github.com/iychoi/parcel/pkg/catalog"
 	"github.com/iychoi/parcel/pkg/cli"
+	"github.com/iychoi/parcel/pkg/estimate"
 	"github.com/iychoi/parcel/pkg/kubernetes"
+	"github.com/iychoi/parcel/pkg/query"
+	"github.com/iychoi/parcel/pkg/webdav"
 )
 
-type CommandHandler func([]string)
+// exit codes, 2 is used by the flag package for invalid arguments
+const (
+	exitCodeError            = 1
+	exitCodeNotFound         = 3
+	exitCodeUnauthorized     = 4
+	exitCodeBadRequest       = 5
+	exitCodeServerError      = 6
+	exitCodeMalformedPayload = 7
+	exitCodeUnreachable      = 8
+	exitCodeCancelled        = 130
+)
+
+type CommandHandler func(context.Context, []string)
 
 type Command struct {
 	Name        string
@@ -37,39 +62,83 @@ var (
 	config      cli.Config
 	trace       bool
 	short       bool
+	refresh     bool
+	offline     bool
+	cacheTTL    time.Duration
+	timeout     time.Duration
+	retries     int
 )
 
 func main() {
-	var catalogServiceURL string
-	var namespace string
-	var kubernetesConfigPath string
+	defaultKubeConfigPath, _ := kubernetes.GetHomeKubernetesConfigPath()
+
+	catalogServiceURL := catalog.CatalogServiceURL
+	namespace := kubernetes.VolumeNamespace
+	kubernetesConfigPath := defaultKubeConfigPath
+	cacheTTL = catalog.CacheTTL
+	timeout = catalog.DefaultTimeout
+	retries = catalog.DefaultRetries
 
 	// read config
 	if cli.CheckConfig() {
-		config, err := cli.GetConfig()
+		loadedConfig, err := cli.GetConfig()
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		catalogServiceURL = config.CatalogServiceURL
-		namespace = config.Namespace
-		kubernetesConfigPath = config.KubernetesConfigPath
+		// keep settings that have no flags
+		config = *loadedConfig
+
+		if len(config.CatalogServiceURL) > 0 {
+			catalogServiceURL = config.CatalogServiceURL
+		}
+		if len(config.Namespace) > 0 {
+			namespace = config.Namespace
+		}
+		if len(config.KubernetesConfigPath) > 0 {
+			kubernetesConfigPath = config.KubernetesConfigPath
+		}
+		if len(config.CacheTTL) > 0 {
+			cacheTTL, err = time.ParseDuration(config.CacheTTL)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if len(config.Timeout) > 0 {
+			timeout, err = time.ParseDuration(config.Timeout)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if config.Retries != nil {
+			retries = *config.Retries
+		}
 	}
 
 	var version bool
 
-	defaultKubeConfigPath, _ := kubernetes.GetHomeKubernetesConfigPath()
-
 	// Parse parameters
 	flag.BoolVar(&version, "version", false, "Print cli version information")
-	flag.StringVar(&catalogServiceURL, "svcurl", catalog.CatalogServiceURL, "Set Catalog Service URL")
-	flag.StringVar(&kubernetesConfigPath, "kubeconfig", defaultKubeConfigPath, "Set a kubernetes config path")
-	flag.StringVar(&namespace, "namespace", kubernetes.VolumeNamespace, "Set a volume namespace")
+	flag.StringVar(&catalogServiceURL, "svcurl", catalogServiceURL, "Set Catalog Service URL, or a file:// URL of a local catalog file or directory")
+	flag.StringVar(&kubernetesConfigPath, "kubeconfig", kubernetesConfigPath, "Set a kubernetes config path")
+	flag.StringVar(&namespace, "namespace", namespace, "Set a volume namespace")
+	flag.DurationVar(&cacheTTL, "cache-ttl", cacheTTL, "Set how long a cached catalog is used before revalidation")
+	flag.BoolVar(&refresh, "refresh", false, "Revalidate cached catalog with Catalog Service")
+	flag.BoolVar(&offline, "offline", false, "Use cached catalog only, without contacting Catalog Service")
+	flag.DurationVar(&timeout, "timeout", timeout, "Set a timeout of each request to Catalog Service, 0 for no timeout")
+	flag.IntVar(&retries, "retries", retries, "Set the number of retries of a failed request to Catalog Service")
 	flag.BoolVar(&trace, "trace", false, "Trace communication with Catalog Service")
 	flag.BoolVar(&short, "short", false, "Print short content")
 
 	flag.Parse()
 
+	// a Catalog Service URL given explicitly overrides federated catalogs in config
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "svcurl" {
+			config.Catalogs = nil
+		}
+	})
+
 	// Handle Version
 	if version {
 		info, err := cli.GetVersionJSON()
@@ -86,11 +155,12 @@ func main() {
 	initCommandHandlers()
 
 	// set config
-	config = cli.Config{
-		CatalogServiceURL:    catalogServiceURL,
-		Namespace:            namespace,
-		KubernetesConfigPath: kubernetesConfigPath,
-	}
+	config.CatalogServiceURL = catalogServiceURL
+	config.Namespace = namespace
+	config.KubernetesConfigPath = kubernetesConfigPath
+	config.CacheTTL = cacheTTL.String()
+	config.Timeout = timeout.String()
+	config.Retries = &retries
 
 	// save config file
 	if !cli.CheckConfig() {
@@ -116,7 +186,22 @@ func main() {
 		os.Exit(1)
 	}
 
-	commandObject.Handler(args[1:])
+	// cancel in-flight requests on Ctrl-C
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Printf("Cancelling...")
+		cancel()
+
+		<-signals
+		os.Exit(exitCodeCancelled)
+	}()
+
+	commandObject.Handler(ctx, args[1:])
 
 	os.Exit(0)
 }
@@ -124,9 +209,21 @@ func main() {
 func initCommandHandlers() {
 	commandList = map[string]Command{
 		"help":    Command{"help", "show help message", helpHandler},
+		"version": Command{"version", "show version information", versionHandler},
+		"login":   Command{"login", "store credentials for Catalog Service", loginHandler},
 		"list":    Command{"list", "list available datasets", listHandler},
-		"find":    Command{"find", "search datasets by keywords", searchHandler},
-		"search":  Command{"search", "search datasets by keywords", searchHandler},
+		"find":    Command{"find", "search datasets by a query", searchHandler},
+		"search":  Command{"search", "search datasets by a query", searchHandler},
+		"info":    Command{"info", "show details and orders of a dataset", infoHandler},
+		"ls":      Command{"ls", "list files of a WebDAV dataset", lsHandler},
+		"fetch":   Command{"fetch", "download a dataset to local disk", fetchHandler},
+		"check":   Command{"check", "check that datasets are reachable", checkHandler},
+		"cite":    Command{"cite", "export citations of datasets", citeHandler},
+		"monitor": Command{"monitor", "check datasets periodically and keep their health history", monitorHandler},
+		"publish": Command{"publish", "publish a dataset to the catalog", publishHandler},
+		"edit":    Command{"edit", "edit a dataset of the catalog", editHandler},
+		"retract": Command{"retract", "retract a dataset from the catalog", retractHandler},
+		"catalog": Command{"catalog", "serve a local catalog for development", catalogHandler},
 		"order":   Command{"order", "order a dataset", orderHandler},
 		"mount":   Command{"mount", "order a dataset", orderHandler},
 		"show":    Command{"show", "show orders", showHandler},
@@ -142,86 +239,255 @@ func showCommands() {
 	}
 }
 
-func listHandler(args []string) {
-	client, err := catalog.NewCatalogServiceClient(config.CatalogServiceURL, trace)
-	if err != nil {
-		log.Fatal(err)
+// parseFlags parses flags that may come after positional arguments, and returns the positional arguments
+func parseFlags(flagset *flag.FlagSet, args []string) []string {
+	positional := []string{}
+	for {
+		flagset.Parse(args)
+
+		rest := flagset.Args()
+		if len(rest) == 0 {
+			break
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
 	}
+	return positional
+}
 
-	datasets, err := client.GetAllDatasets()
-	if err != nil {
-		log.Fatal(err)
+// exitWithError prints a message describing the error and exits with a code for its kind
+func exitWithError(err error) {
+	code := exitCodeError
+	message := ""
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		code = exitCodeCancelled
+		message = "Cancelled"
+	case errors.Is(err, catalog.ErrDatasetNotFound):
+		code = exitCodeNotFound
+		message = "Could not find the dataset in the catalog"
+	case errors.Is(err, catalog.ErrNotFound):
+		code = exitCodeNotFound
+		message = "Catalog Service does not have the requested resource, check the Catalog Service URL (-svcurl)"
+	case errors.Is(err, errNoCredentials):
+		code = exitCodeUnauthorized
+		message = "Changing datasets requires credentials for the catalog"
+	case errors.Is(err, catalog.ErrUnauthorized):
+		code = exitCodeUnauthorized
+		message = "Catalog Service denied access to the requested resource, run 'parcel login' to store valid credentials"
+	case errors.Is(err, catalog.ErrBadRequest):
+		code = exitCodeBadRequest
+		message = "Catalog Service rejected the request"
+	case errors.Is(err, catalog.ErrServer):
+		code = exitCodeServerError
+		message = "Catalog Service failed to process the request, try again later"
+	case errors.Is(err, catalog.ErrMalformedPayload):
+		code = exitCodeMalformedPayload
+		message = "Catalog Service returned an unexpected response, check the Catalog Service URL (-svcurl)"
 	}
 
-	for _, ds := range datasets {
-		ds.PrintDataset(short, catalog.ShortDescriptionLen)
-		fmt.Printf("\n")
+	if len(message) > 0 {
+		log.Printf("%s\n  %v\n", message, err)
+	} else {
+		log.Println(err)
 	}
+	os.Exit(code)
 }
 
-func searchHandler(args []string) {
-	keywords := []string{}
-	for _, arg := range args {
-		if len(arg) < 4 {
-			log.Printf("Keyword '%s' is ignored because it is too short", arg)
-			continue
+// newCatalog returns a catalog for the configured URL, or a federated catalog if config has multiple catalogs
+func newCatalog() (catalog.Catalog, error) {
+	if len(config.Catalogs) == 0 {
+		return newCatalogForURL(config.CatalogServiceURL)
+	}
+
+	namedCatalogs := []catalog.NamedCatalog{}
+	for _, endpoint := range config.Catalogs {
+		client, err := newCatalogForURL(endpoint.URL)
+		if err != nil {
+			return nil, fmt.Errorf("could not use catalog '%s' - %v", endpoint.Name, err)
+		}
+
+		namedCatalogs = append(namedCatalogs, catalog.NamedCatalog{
+			Name:    endpoint.Name,
+			Catalog: client,
+		})
+	}
+	return catalog.NewFederatedCatalog(namedCatalogs)
+}
+
+// getCatalogURL returns the URL of the catalog the dataset is from
+func getCatalogURL(ds *dataset.Dataset) string {
+	if catalogName, ok := ds.Tags[catalog.SourceCatalogTag]; ok {
+		for _, endpoint := range config.Catalogs {
+			if endpoint.Name == catalogName {
+				return endpoint.URL
+			}
+		}
+	}
+	return config.CatalogServiceURL
+}
+
+// getCatalogEndpointURL returns the URL of the named catalog
+// The name can be empty if a single catalog is configured.
+func getCatalogEndpointURL(catalogName string) (string, error) {
+	if len(config.Catalogs) == 0 {
+		if len(catalogName) > 0 {
+			return "", fmt.Errorf("unknown catalog '%s', no named catalogs are configured", catalogName)
+		}
+		return config.CatalogServiceURL, nil
+	}
+
+	names := []string{}
+	for _, endpoint := range config.Catalogs {
+		names = append(names, endpoint.Name)
+	}
+
+	if len(catalogName) == 0 && len(config.Catalogs) > 1 {
+		return "", fmt.Errorf("multiple catalogs are configured, give a catalog name (%s)", strings.Join(names, ", "))
+	}
+
+	for _, endpoint := range config.Catalogs {
+		if len(catalogName) == 0 || endpoint.Name == catalogName {
+			return endpoint.URL, nil
 		}
+	}
+	return "", fmt.Errorf("unknown catalog '%s', configured catalogs are %s", catalogName, strings.Join(names, ", "))
+}
 
-		keywords = append(keywords, arg)
+// newCatalogForURL returns a catalog for the URL
+func newCatalogForURL(catalogURL string) (catalog.Catalog, error) {
+	options := catalog.ClientOptions{
+		Trace:   trace,
+		Refresh: refresh,
+		Offline: offline,
+		Timeout: timeout,
+		Retries: retries,
 	}
 
-	client, err := catalog.NewCatalogServiceClient(config.CatalogServiceURL, trace)
+	store, err := loadCredentialStore()
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("Credentials are not used - %v", err)
+	} else {
+		options.TokenSource = auth.NewStoreTokenSource(store, catalogURL)
 	}
 
-	datasets, err := client.SearchDatasets(keywords)
+	cacheDir, err := catalog.GetDefaultCacheDir()
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("Catalog cache is disabled - %v", err)
+	} else {
+		options.Cache = catalog.NewDatasetCache(cacheDir, cacheTTL)
 	}
 
-	for _, ds := range datasets {
-		ds.PrintDataset(short, catalog.ShortDescriptionLen)
-		fmt.Printf("\n")
+	return catalog.NewCatalog(catalogURL, &options)
+}
+
+// newEstimator returns a size estimator keeping estimates with the catalog cache
+func newEstimator() *estimate.Estimator {
+	cacheDir, err := catalog.GetDefaultCacheDir()
+	if err != nil {
+		log.Printf("Size estimate cache is disabled - %v", err)
+		cacheDir = ""
 	}
+
+	return estimate.NewEstimator(cacheDir, estimate.EstimateTTL, &webdav.ClientOptions{
+		Trace:   trace,
+		Timeout: timeout,
+	})
 }
 
-func orderHandler(args []string) {
-	client, err := catalog.NewCatalogServiceClient(config.CatalogServiceURL, trace)
+// estimateDataset returns a size estimate of the dataset, or nil if it is unknown
+func estimateDataset(ctx context.Context, estimator *estimate.Estimator, ds *dataset.Dataset, crawl bool) *estimate.Estimate {
+	est, err := estimator.Estimate(ctx, ds, crawl)
 	if err != nil {
-		log.Fatal(err)
+		if !errors.Is(err, estimate.ErrNoEstimate) && ctx.Err() == nil {
+			log.Printf("Could not estimate size of dataset [%s] - %v", catalog.GetDatasetRef(ds), err)
+		}
+		return nil
 	}
+	return est
+}
 
-	datasets, err := client.SelectDatasets(args)
+func listHandler(ctx context.Context, args []string) {
+	var limit int
+	var offset int
+	var crawl bool
+
+	flagset := flag.NewFlagSet("list", flag.ExitOnError)
+	flagset.IntVar(&limit, "limit", 0, "Set a max number of datasets to show")
+	flagset.IntVar(&offset, "offset", 0, "Set the number of datasets to skip")
+	flagset.BoolVar(&crawl, "estimate", false, "Estimate sizes of datasets without size metadata by crawling them")
+	flagset.Parse(args)
+
+	estimator := newEstimator()
+
+	client, err := newCatalog()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	volumeManager, err := kubernetes.NewVolumeManager(config.KubernetesConfigPath, config.Namespace)
+	iter := client.IterateDatasets(ctx, offset, limit)
+	defer iter.Close()
+
+	for {
+		ds, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			exitWithError(err)
+		}
+
+		printDataset(ds, nil, estimateDataset(ctx, estimator, ds, crawl))
+		fmt.Printf("\n")
+	}
+}
+
+func searchHandler(ctx context.Context, args []string) {
+	options := catalog.SearchOptions{}
+	var crawl bool
+
+	flagset := flag.NewFlagSet("search", flag.ExitOnError)
+	flagset.IntVar(&options.Page, "page", 0, "Set a page number to show, starting from 1")
+	flagset.IntVar(&options.Limit, "limit", 0, "Set a max number of datasets per page")
+	flagset.StringVar(&options.Sort, "sort", "", "Sort datasets by a field (id or name), prefix with '-' for a descending order")
+	flagset.BoolVar(&crawl, "estimate", false, "Estimate sizes of datasets without size metadata by crawling them")
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: search [options] <query>\n")
+		fmt.Fprintf(flagset.Output(), "  A query combines terms with AND, OR, NOT and parentheses, adjacent terms are combined with AND.\n")
+		fmt.Fprintf(flagset.Output(), "  A term is a word or a \"quoted phrase\", optionally scoped to a field, e.g. name:genome, scheme:irods.\n")
+		fmt.Fprintf(flagset.Output(), "  Fields: %s\n", strings.Join([]string{query.FieldID, query.FieldName, query.FieldDescription, query.FieldCreator, query.FieldHost, query.FieldRights, query.FieldURL, query.FieldScheme, query.FieldTag}, ", "))
+		fmt.Fprintf(flagset.Output(), "  Terms shorter than %d characters match whole words only.\n", query.MinSubstringLen)
+		flagset.PrintDefaults()
+	}
+	flagset.Parse(args)
+
+	q, err := query.Parse(query.JoinArgs(flagset.Args()))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = volumeManager.CreateStorageClass()
+	client, err := newCatalog()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	log.Printf("Ordering %d datasets...\n", len(datasets))
-	for _, ds := range datasets {
-		log.Printf("  Dataset: [%v] %s\n", ds.ID, ds.Name)
+	datasets, err := catalog.QueryDatasets(ctx, client, q, &options)
+	if err != nil {
+		exitWithError(err)
+	}
 
-		mount, err := volumeManager.CreateVolume(ds)
-		if err != nil {
-			log.Fatal(err)
-		}
+	estimator := newEstimator()
 
-		log.Printf("    VolumeName: %s\n", mount.PersistentVolume.GetName())
-		log.Printf("    ClaimName: %s\n", mount.PersistentVolumeClaim.GetName())
+	for _, ds := range datasets {
+		printDataset(ds, q, estimateDataset(ctx, estimator, ds, crawl))
+		fmt.Printf("\n")
 	}
 }
 
-func showHandler(args []string) {
+func showHandler(ctx context.Context, args []string) {
 	volumeManager, err := kubernetes.NewVolumeManager(config.KubernetesConfigPath, config.Namespace)
 	if err != nil {
 		log.Fatal(err)
@@ -235,12 +501,12 @@ func showHandler(args []string) {
 
 	for _, mount := range mounts {
 		log.Printf("  VolumeName: %s\n", mount.PersistentVolume.GetName())
-		log.Printf("    Dataset: [%v] %s\n", mount.Dataset.ID, mount.Dataset.Name)
+		log.Printf("    Dataset: [%s] %s\n", catalog.GetDatasetRef(mount.Dataset), mount.Dataset.Name)
 		log.Printf("    ClaimName: %s\n", mount.PersistentVolumeClaim.GetName())
 	}
 }
 
-func returnHandler(args []string) {
+func returnHandler(ctx context.Context, args []string) {
 	volumeManager, err := kubernetes.NewVolumeManager(config.KubernetesConfigPath, config.Namespace)
 	if err != nil {
 		log.Fatal(err)
@@ -254,7 +520,7 @@ func returnHandler(args []string) {
 		}
 
 		log.Printf("  VolumeName: %s\n", mount.PersistentVolume.GetName())
-		log.Printf("    Dataset: [%v] %s\n", mount.Dataset.ID, mount.Dataset.Name)
+		log.Printf("    Dataset: [%s] %s\n", catalog.GetDatasetRef(mount.Dataset), mount.Dataset.Name)
 		log.Printf("    ClaimName: %s\n", mount.PersistentVolumeClaim.GetName())
 
 		err = volumeManager.DeleteVolume(volumeName)
@@ -264,6 +530,91 @@ func returnHandler(args []string) {
 	}
 }
 
-func helpHandler(args []string) {
+func versionHandler(ctx context.Context, args []string) {
+	var server bool
+
+	flagset := flag.NewFlagSet("version", flag.ExitOnError)
+	flagset.BoolVar(&server, "server", false, "Show Catalog Service version and API negotiation result")
+	flagset.Parse(args)
+
+	info, err := cli.GetVersionJSON()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(info)
+
+	if server {
+		client, err := newCatalog()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		federated, ok := client.(*catalog.FederatedCatalog)
+		if !ok {
+			printJSON(getServerInfo(ctx, config.CatalogServiceURL, client))
+			return
+		}
+
+		// each of the federated catalogs is discovered separately
+		infoList := []namedServerInfo{}
+		for _, namedCatalog := range federated.GetCatalogs() {
+			catalogURL, err := getCatalogEndpointURL(namedCatalog.Name)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			infoList = append(infoList, namedServerInfo{
+				Name:       namedCatalog.Name,
+				ServerInfo: getServerInfo(ctx, catalogURL, namedCatalog.Catalog),
+			})
+		}
+		printJSON(infoList)
+	}
+}
+
+// namedServerInfo is server info of one of the federated catalogs
+type namedServerInfo struct {
+	Name string `json:"name"`
+	*catalog.ServerInfo
+}
+
+// getServerInfo returns the result of API discovery of the catalog, discovery failures are reported as warnings
+func getServerInfo(ctx context.Context, catalogURL string, client catalog.Catalog) *catalog.ServerInfo {
+	serviceClient, ok := client.(*catalog.ParcelCatalogServiceClient)
+	if !ok {
+		return &catalog.ServerInfo{
+			URL:     catalogURL,
+			Message: "Catalog is not served by Catalog Service",
+		}
+	}
+
+	// legacy endpoints are used if discovery fails
+	serverInfo, err := serviceClient.GetServerInfo(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			exitWithError(err)
+		}
+
+		if errors.Is(err, catalog.ErrNotFound) {
+			serverInfo.Message = fmt.Sprintf("Catalog Service does not serve a discovery document, assuming a legacy server - %v", err)
+		} else {
+			serverInfo.Message = fmt.Sprintf("Catalog Service version is unknown, assuming a legacy server - %v", err)
+		}
+		log.Printf("Warning: %s", serverInfo.Message)
+	}
+	return serverInfo
+}
+
+func printJSON(value interface{}) {
+	marshalled, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(string(marshalled))
+}
+
+func helpHandler(ctx context.Context, args []string) {
 	showCommands()
 }
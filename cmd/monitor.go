@@ -0,0 +1,187 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"github.com/iychoi/parcel/pkg/catalog"
+	"github.com/iychoi/parcel/pkg/kubernetes"
+	"github.com/iychoi/parcel/pkg/monitor"
+)
+
+const (
+	// defaultMonitorThreshold is how long an ordered dataset can be unreachable before monitor fails
+	defaultMonitorThreshold = 30 * time.Minute
+)
+
+func monitorHandler(ctx context.Context, args []string) {
+	var ordered bool
+	var interval time.Duration
+	var history int
+	var statePath string
+	var threshold time.Duration
+
+	flagset := flag.NewFlagSet("monitor", flag.ExitOnError)
+	flagset.BoolVar(&ordered, "ordered", false, "Check only datasets ordered in the namespace")
+	flagset.DurationVar(&interval, "interval", 0, "Repeat checks at the interval until interrupted, 0 to check once")
+	flagset.IntVar(&history, "history", monitor.DefaultHistory, "Set the number of checks kept per dataset")
+	flagset.StringVar(&statePath, "state", "", "Set a state file path, defaults to a file in the cache directory")
+	flagset.DurationVar(&threshold, "threshold", defaultMonitorThreshold, "Exit with an error if an ordered dataset is unreachable longer than this")
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: monitor [options] [id|name|pattern]...\n")
+		fmt.Fprintf(flagset.Output(), "  Checks all datasets of the catalog, the selected datasets, or the ordered datasets.\n")
+		flagset.PrintDefaults()
+	}
+	selectors := parseFlags(flagset, args)
+
+	if len(statePath) == 0 {
+		cacheDir, err := catalog.GetDefaultCacheDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+		statePath = monitor.GetDefaultStatePath(cacheDir)
+	}
+
+	state, err := monitor.LoadState(statePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// ordered datasets are needed to apply the threshold even if all datasets are checked
+	volumeManager, err := kubernetes.NewVolumeManager(config.KubernetesConfigPath, config.Namespace)
+	if err != nil {
+		if ordered {
+			log.Fatal(err)
+		}
+		log.Printf("Ordered datasets are unknown, the threshold is not applied - %v", err)
+		volumeManager = nil
+	}
+
+	for {
+		alerts := monitorOnce(ctx, state, volumeManager, ordered, selectors, history, threshold)
+		if ctx.Err() != nil {
+			exitWithError(ctx.Err())
+		}
+
+		err = state.Save()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if interval <= 0 {
+			if alerts > 0 {
+				os.Exit(exitCodeUnreachable)
+			}
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// monitorOnce checks datasets, prints a summary and returns the number of ordered datasets failing past the threshold
+func monitorOnce(ctx context.Context, state *monitor.State, volumeManager *kubernetes.ParcelVolumeManager, ordered bool, selectors []string, history int, threshold time.Duration) int {
+	orderedRefs := map[string]bool{}
+	orderedDatasets := []*dataset.Dataset{}
+	if volumeManager != nil {
+		mounts, err := volumeManager.ListVolumes()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, mount := range mounts {
+			ref := catalog.GetDatasetRef(mount.Dataset)
+			if !orderedRefs[ref] {
+				orderedRefs[ref] = true
+				orderedDatasets = append(orderedDatasets, mount.Dataset)
+			}
+		}
+	}
+
+	var datasets []*dataset.Dataset
+	if ordered {
+		datasets = orderedDatasets
+	} else {
+		client, err := newCatalog()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if len(selectors) > 0 {
+			datasets = resolveDatasets(ctx, client, selectors, nil)
+		} else {
+			datasets, err = client.GetAllDatasets(ctx)
+			if err != nil {
+				exitWithError(err)
+			}
+		}
+	}
+
+	checkedAt := time.Now()
+	results := probeDatasets(ctx, datasets)
+	if ctx.Err() != nil {
+		return 0
+	}
+
+	healths := []*monitor.DatasetHealth{}
+	for idx, ds := range datasets {
+		health := state.Record(catalog.GetDatasetRef(ds), ds.Name, results[idx], checkedAt, history)
+		healths = append(healths, health)
+	}
+
+	alerts := 0
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "DATASET\tNAME\tORDERED\tSTATUS\tAVAILABILITY\tAVG LATENCY\tFAILING FOR\n")
+	for _, health := range healths {
+		status := "OK"
+		if last := health.LastCheck(); last != nil && !last.OK {
+			status = fmt.Sprintf("FAILED at %s", last.Stage)
+		}
+
+		failingFor := "-"
+		if !health.FailingSince.IsZero() {
+			failingFor = health.FailingFor(checkedAt).Round(time.Second).String()
+		}
+
+		orderedMark := ""
+		if orderedRefs[health.Ref] {
+			orderedMark = "yes"
+			if last := health.LastCheck(); last != nil && !last.OK && health.FailingFor(checkedAt) >= threshold {
+				orderedMark = "yes (ALERT)"
+				alerts++
+			}
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%.1f%% of %d\t%s\t%s\n", health.Ref, health.Name, orderedMark, status,
+			health.Availability()*100, len(health.Checks), health.AverageLatency().Round(time.Millisecond), failingFor)
+	}
+	writer.Flush()
+
+	if alerts > 0 {
+		log.Printf("%d ordered datasets are unreachable longer than %s\n", alerts, threshold)
+	}
+	return alerts
+}
@@ -0,0 +1,333 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"github.com/iychoi/parcel/pkg/catalog"
+	"github.com/iychoi/parcel/pkg/estimate"
+	"github.com/iychoi/parcel/pkg/kubernetes"
+	"github.com/iychoi/parcel/pkg/query"
+)
+
+const (
+	// orderConfirmThreshold is the max number of datasets ordered without confirmation
+	orderConfirmThreshold = 5
+	// defaultEstimateTimeout is a default max time to crawl a dataset for its size
+	defaultEstimateTimeout = time.Minute
+)
+
+func orderHandler(ctx context.Context, args []string) {
+	var queryExpression string
+	var yes bool
+	var noProbe bool
+	var newVolume bool
+	var claimName string
+	var namePrefix string
+	var noWait bool
+	var waitTimeout time.Duration
+	var crawl bool
+	var estimateTimeout time.Duration
+
+	flagset := flag.NewFlagSet("order", flag.ExitOnError)
+	flagset.StringVar(&queryExpression, "query", "", "Order datasets matching a search query")
+	flagset.BoolVar(&yes, "yes", false, fmt.Sprintf("Order more than %d datasets without confirmation", orderConfirmThreshold))
+	flagset.BoolVar(&noProbe, "no-probe", false, "Order without checking that dataset URLs are reachable")
+	flagset.BoolVar(&newVolume, "new", false, "Create a new volume even if the dataset already has a bound volume")
+	flagset.StringVar(&claimName, "name", "", "Set a claim name of the volume, only for a single dataset")
+	flagset.StringVar(&namePrefix, "prefix", kubernetes.DefaultVolumeNamePrefix, "Set a prefix of volume names")
+	flagset.BoolVar(&noWait, "no-wait", false, "Do not wait for volumes to be bound")
+	flagset.DurationVar(&waitTimeout, "wait-timeout", kubernetes.DefaultBindingTimeout, "Set a max time to wait for a volume to be bound")
+	flagset.BoolVar(&crawl, "estimate", false, "Size volumes of datasets without size metadata by crawling them")
+	flagset.DurationVar(&estimateTimeout, "estimate-timeout", defaultEstimateTimeout, "Set a max time to crawl a dataset, the default capacity is used when it is exceeded")
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: order [options] <id|name|pattern>...\n")
+		fmt.Fprintf(flagset.Output(), "  Datasets are selected by IDs (<catalog>/<id> for federated catalogs), exact names or glob patterns of names.\n")
+		flagset.PrintDefaults()
+	}
+	selectors := parseFlags(flagset, args)
+
+	if len(selectors) == 0 && len(queryExpression) == 0 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	err := kubernetes.ValidateVolumeNamePrefix(namePrefix)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var q *query.Query
+	if len(queryExpression) > 0 {
+		q, err = query.Parse(queryExpression)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	client, err := newCatalog()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	datasets := resolveDatasets(ctx, client, selectors, q)
+	if len(claimName) > 0 && len(datasets) > 1 {
+		log.Fatalf("a claim name is given, but %d datasets are selected", len(datasets))
+	}
+
+	if len(datasets) > orderConfirmThreshold && !yes {
+		confirmed, err := confirmOrder(datasets)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if !confirmed {
+			log.Printf("Order is cancelled\n")
+			os.Exit(exitCodeCancelled)
+		}
+	}
+
+	if !noProbe {
+		log.Printf("Checking %d datasets...\n", len(datasets))
+		results := probeDatasets(ctx, datasets)
+		if ctx.Err() != nil {
+			exitWithError(ctx.Err())
+		}
+
+		failed := 0
+		for idx, ds := range datasets {
+			if !results[idx].OK() {
+				log.Printf("  Dataset: [%s] %s\n", catalog.GetDatasetRef(ds), ds.Name)
+				log.Printf("    %s\n", results[idx])
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			log.Printf("%d of %d datasets are unreachable, nothing is ordered (give -no-probe to order anyway)\n", failed, len(datasets))
+			os.Exit(exitCodeUnreachable)
+		}
+	}
+
+	volumeManager, err := kubernetes.NewVolumeManager(config.KubernetesConfigPath, config.Namespace)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = volumeManager.CreateStorageClass()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	estimator := newEstimator()
+
+	log.Printf("Ordering %d datasets...\n", len(datasets))
+	results := []*orderResult{}
+	for _, ds := range datasets {
+		result := &orderResult{
+			dataset: ds,
+		}
+		results = append(results, result)
+
+		if ctx.Err() != nil {
+			result.err = ctx.Err()
+			continue
+		}
+
+		log.Printf("  Dataset: [%s] %s\n", catalog.GetDatasetRef(ds), ds.Name)
+
+		volumeOptions := kubernetes.VolumeOptions{
+			ClaimName:  claimName,
+			NamePrefix: namePrefix,
+			CatalogURL: getCatalogURL(ds),
+			New:        newVolume,
+		}
+
+		result.mount, result.err = volumeManager.FindReusableVolume(ds, &volumeOptions)
+		if result.err != nil {
+			log.Printf("    Failed: %v\n", result.err)
+			continue
+		}
+
+		if result.mount != nil {
+			result.reused = true
+			log.Printf("    Reusing an existing volume (give -new to create another)\n")
+		} else {
+			// the default capacity is used if the size is unknown
+			if est := estimateCapacity(ctx, estimator, ds, crawl, estimateTimeout); est != nil {
+				log.Printf("    Size: %s\n", formatBytes(est.Bytes))
+				volumeOptions.Capacity = est.Bytes
+			}
+
+			result.mount, result.err = volumeManager.CreateVolume(ds, &volumeOptions)
+			if result.err != nil {
+				log.Printf("    Failed: %v\n", result.err)
+				continue
+			}
+		}
+
+		log.Printf("    VolumeName: %s\n", result.mount.PersistentVolume.GetName())
+		log.Printf("    ClaimName: %s\n", result.mount.PersistentVolumeClaim.GetName())
+
+		if !noWait {
+			result.err = waitForBinding(ctx, volumeManager, result, waitTimeout)
+		}
+	}
+
+	if printOrderResults(results) > 0 {
+		os.Exit(exitCodeError)
+	}
+}
+
+// estimateCapacity returns a size estimate of the dataset from metadata or cache, or by crawling it if crawl is true
+// It returns nil if the size is unknown or crawling does not finish in time
+func estimateCapacity(ctx context.Context, estimator *estimate.Estimator, ds *dataset.Dataset, crawl bool, timeout time.Duration) *estimate.Estimate {
+	if !crawl {
+		return estimateDataset(ctx, estimator, ds, false)
+	}
+
+	estimateCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		estimateCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	est := estimateDataset(estimateCtx, estimator, ds, true)
+	if est == nil && estimateCtx.Err() != nil {
+		log.Printf("    Crawling is stopped, using the default capacity\n")
+	}
+	return est
+}
+
+// waitForBinding waits for the volume of the order to be bound, a volume created by the order is deleted if it is not bound
+func waitForBinding(ctx context.Context, volumeManager *kubernetes.ParcelVolumeManager, result *orderResult, timeout time.Duration) error {
+	mount, err := volumeManager.WaitForBinding(ctx, result.mount, timeout, func(status kubernetes.BindingStatus) {
+		log.Printf("    Status: %s (%s)\n", status, status.Elapsed.Round(time.Second))
+	})
+	if err == nil {
+		result.mount = mount
+		return nil
+	}
+
+	bindingErr := &kubernetes.BindingError{}
+	if errors.As(err, &bindingErr) {
+		log.Printf("    Failed: %v\n", bindingErr)
+		for _, event := range bindingErr.Events {
+			log.Printf("      Event: %s\n", event)
+		}
+	}
+
+	if !result.reused {
+		deleteErr := volumeManager.DeleteVolume(result.mount.PersistentVolume.GetName())
+		if deleteErr != nil {
+			return fmt.Errorf("%v, and could not roll back volume %s - %v", err, result.mount.PersistentVolume.GetName(), deleteErr)
+		}
+		return fmt.Errorf("%v, volume %s is rolled back", err, result.mount.PersistentVolume.GetName())
+	}
+	return err
+}
+
+// orderResult is an outcome of ordering a dataset
+type orderResult struct {
+	dataset *dataset.Dataset
+	mount   *kubernetes.DatasetMount
+	reused  bool
+	err     error
+}
+
+// printOrderResults prints a summary of a batch order and returns the number of failed datasets
+func printOrderResults(results []*orderResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+		}
+	}
+
+	if failed == 0 {
+		log.Printf("Ordered %d datasets\n", len(results))
+		return 0
+	}
+
+	log.Printf("Ordered %d of %d datasets, failed datasets are not ordered:\n", len(results)-failed, len(results))
+	for _, result := range results {
+		status := "ordered"
+		if result.reused {
+			status = "reused"
+		}
+
+		if result.err != nil {
+			status = fmt.Sprintf("failed - %v", result.err)
+		}
+		log.Printf("  [%s] %s: %s\n", catalog.GetDatasetRef(result.dataset), result.dataset.Name, status)
+	}
+	return failed
+}
+
+// resolveDatasets selects datasets by selectors and a query, unmatched or ambiguous selectors are reported and exit
+func resolveDatasets(ctx context.Context, client catalog.Catalog, selectors []string, q *query.Query) []*dataset.Dataset {
+	selection, err := catalog.SelectDatasetsBy(ctx, client, selectors, q)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	err = selection.Err()
+	if err != nil {
+		for _, selector := range selection.Unmatched {
+			log.Printf("'%s' matched no datasets\n", selector)
+		}
+
+		for selector, matches := range selection.Ambiguous {
+			log.Printf("'%s' matched %d datasets, use one of the IDs\n", selector, len(matches))
+			for _, ds := range matches {
+				log.Printf("  [%s] %s\n", catalog.GetDatasetRef(ds), ds.Name)
+			}
+		}
+		exitWithError(err)
+	}
+	return selection.Datasets
+}
+
+// confirmOrder lists datasets and asks the user to proceed
+func confirmOrder(datasets []*dataset.Dataset) (bool, error) {
+	if !isTerminal(os.Stdin) {
+		return false, fmt.Errorf("ordering %d datasets requires confirmation, give -yes to order without confirmation", len(datasets))
+	}
+
+	fmt.Fprintf(os.Stderr, "Selected %d datasets:\n", len(datasets))
+	for _, ds := range datasets {
+		fmt.Fprintf(os.Stderr, "  [%s] %s\n", catalog.GetDatasetRef(ds), ds.Name)
+	}
+	fmt.Fprintf(os.Stderr, "Order all of them? [y/N] ")
+
+	reader := bufio.NewReader(os.Stdin)
+	line, err := reader.ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return false, err
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"github.com/iychoi/parcel/pkg/catalog"
+	"github.com/iychoi/parcel/pkg/estimate"
+	"github.com/iychoi/parcel/pkg/query"
+)
+
+const (
+	highlightStart = "\x1b[1;33m"
+	highlightEnd   = "\x1b[0m"
+)
+
+// isTerminal checks if the file is a terminal
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// printDataset prints a dataset with its size estimate if known, terms of the query are highlighted on a terminal
+func printDataset(ds *dataset.Dataset, q *query.Query, est *estimate.Estimate) {
+	highlight := func(field string, text string) string {
+		return text
+	}
+
+	if q != nil && isTerminal(os.Stdout) {
+		highlight = func(field string, text string) string {
+			return q.Highlight(field, text, func(matched string) string {
+				return highlightStart + matched + highlightEnd
+			})
+		}
+	}
+
+	fmt.Printf("[%s] %s\n", catalog.GetDatasetRef(ds), highlight(query.FieldName, ds.Name))
+	if short {
+		fmt.Printf("  Creator     : %s\n", highlight(query.FieldCreator, ds.Creator))
+		fmt.Printf("  Rights      : %s\n", highlight(query.FieldRights, ds.Rights))
+		if len(ds.Description) > catalog.ShortDescriptionLen {
+			fmt.Printf("  Description : %s...[more]\n", highlight(query.FieldDescription, ds.Description[:catalog.ShortDescriptionLen]))
+		} else {
+			fmt.Printf("  Description : %s\n", highlight(query.FieldDescription, ds.Description))
+		}
+		printEstimate(est)
+		return
+	}
+
+	fmt.Printf("  Name        : %s\n", highlight(query.FieldName, ds.Name))
+	fmt.Printf("  Creator     : %s\n", highlight(query.FieldCreator, ds.Creator))
+	fmt.Printf("  Host        : %s\n", highlight(query.FieldHost, ds.Host))
+	fmt.Printf("  Description : %s\n", highlight(query.FieldDescription, ds.Description))
+	fmt.Printf("  Rights      : %s\n", highlight(query.FieldRights, ds.Rights))
+	fmt.Printf("  URL         : %s\n", highlight(query.FieldURL, ds.URL))
+	printEstimate(est)
+
+	keys := []string{}
+	for k := range ds.Tags {
+		// the source catalog is shown in the ref
+		if k != catalog.SourceCatalogTag {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Printf("  %-12s: %s\n", k, highlight(query.FieldTag, ds.Tags[k]))
+	}
+}
+
+func printEstimate(est *estimate.Estimate) {
+	if est == nil {
+		return
+	}
+
+	if est.Files >= 0 {
+		fmt.Printf("  Size        : %s in %d files\n", formatBytes(est.Bytes), est.Files)
+	} else {
+		fmt.Printf("  Size        : %s\n", formatBytes(est.Bytes))
+	}
+}
+
+// formatBytes returns a human readable size, e.g. 1.5 GiB
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div := int64(unit)
+	exp := 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,477 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"github.com/iychoi/parcel/pkg/catalog"
+	"github.com/iychoi/parcel/pkg/kubernetes"
+)
+
+// tagFlags collects repeated key=value flags
+type tagFlags map[string]string
+
+func (tags tagFlags) String() string {
+	pairs := []string{}
+	for k, v := range tags {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (tags tagFlags) Set(value string) error {
+	idx := strings.Index(value, "=")
+	if idx <= 0 {
+		return fmt.Errorf("expected key=value")
+	}
+	tags[strings.TrimSpace(value[:idx])] = strings.TrimSpace(value[idx+1:])
+	return nil
+}
+
+// stringFlags collects repeated flags
+type stringFlags []string
+
+func (values *stringFlags) String() string {
+	return strings.Join(*values, ",")
+}
+
+func (values *stringFlags) Set(value string) error {
+	*values = append(*values, value)
+	return nil
+}
+
+// datasetFlags binds flags setting dataset fields
+type datasetFlags struct {
+	fields map[string]*string
+	tags   tagFlags
+}
+
+func newDatasetFlags(flagset *flag.FlagSet) *datasetFlags {
+	flags := &datasetFlags{
+		fields: map[string]*string{},
+		tags:   tagFlags{},
+	}
+
+	for _, field := range []string{"name", "url", "description", "creator", "host", "rights"} {
+		flags.fields[field] = flagset.String(field, "", fmt.Sprintf("Set the %s of the dataset", field))
+	}
+	flagset.Var(flags.tags, "tag", "Set a tag of the dataset as key=value, can be repeated")
+	return flags
+}
+
+// apply sets fields of the dataset given by flags, flags not given keep the fields
+func (flags *datasetFlags) apply(flagset *flag.FlagSet, ds *dataset.Dataset) {
+	flagset.Visit(func(f *flag.Flag) {
+		value, ok := flags.fields[f.Name]
+		if !ok {
+			return
+		}
+
+		switch f.Name {
+		case "name":
+			ds.Name = *value
+		case "url":
+			ds.URL = *value
+		case "description":
+			ds.Description = *value
+		case "creator":
+			ds.Creator = *value
+		case "host":
+			ds.Host = *value
+		case "rights":
+			ds.Rights = *value
+		}
+	})
+
+	if len(flags.tags) > 0 && ds.Tags == nil {
+		ds.Tags = map[string]string{}
+	}
+
+	for k, v := range flags.tags {
+		ds.Tags[k] = v
+	}
+}
+
+// isSet checks if any of the field flags is given
+func (flags *datasetFlags) isSet(flagset *flag.FlagSet) bool {
+	set := len(flags.tags) > 0
+	flagset.Visit(func(f *flag.Flag) {
+		if _, ok := flags.fields[f.Name]; ok {
+			set = true
+		}
+	})
+	return set
+}
+
+// validateDataset checks that the dataset has a name and a URL that can be mounted
+func validateDataset(ds *dataset.Dataset) error {
+	if len(strings.TrimSpace(ds.Name)) == 0 {
+		return fmt.Errorf("dataset has no name")
+	}
+
+	if len(strings.TrimSpace(ds.URL)) == 0 {
+		return fmt.Errorf("dataset '%s' has no URL", ds.Name)
+	}
+
+	_, err := kubernetes.GetClientType(ds)
+	if err != nil {
+		return fmt.Errorf("dataset '%s' cannot be mounted - %v", ds.Name, err)
+	}
+
+	// the catalog tag is given by parcel, not stored in catalogs
+	delete(ds.Tags, catalog.SourceCatalogTag)
+	return nil
+}
+
+// newPublisher returns a catalog that accepts changes, selected by name if multiple catalogs are configured
+// It fails if no credentials are stored for the catalog, as catalogs only accept changes from logged in users.
+func newPublisher(catalogName string) (catalog.Catalog, catalog.Publisher, error) {
+	catalogURL, err := getCatalogEndpointURL(catalogName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := newCatalogForURL(catalogURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publisher, ok := client.(catalog.Publisher)
+	if !ok {
+		return nil, nil, fmt.Errorf("catalog %s does not support publishing", catalogURL)
+	}
+
+	err = checkCredentials(catalogName, catalogURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, publisher, nil
+}
+
+// checkCredentials checks that credentials for the catalog are stored
+func checkCredentials(catalogName string, catalogURL string) error {
+	loginCommand := "parcel login"
+	if len(catalogName) > 0 {
+		loginCommand = fmt.Sprintf("parcel login -catalog %s", catalogName)
+	}
+
+	store, err := loadCredentialStore()
+	if err != nil {
+		return fmt.Errorf("%w - could not read credentials for %s, run '%s' - %v", errNoCredentials, catalogURL, loginCommand, err)
+	}
+
+	if store.Get(catalogURL) == nil {
+		return fmt.Errorf("%w - no credentials are stored for %s, run '%s'", errNoCredentials, catalogURL, loginCommand)
+	}
+	return nil
+}
+
+// readSingleDataset reads a file holding exactly one dataset
+func readSingleDataset(path string) (*dataset.Dataset, error) {
+	datasets, err := catalog.ReadDatasetFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(datasets) != 1 {
+		return nil, fmt.Errorf("expected one dataset in %s, found %d", path, len(datasets))
+	}
+	return datasets[0], nil
+}
+
+func publishHandler(ctx context.Context, args []string) {
+	var catalogName string
+	var from string
+
+	flagset := flag.NewFlagSet("publish", flag.ExitOnError)
+	flagset.StringVar(&catalogName, "catalog", "", "Set a catalog name to publish to, if multiple catalogs are configured")
+	flagset.StringVar(&from, "from", "", "Read datasets from a JSON or YAML file")
+	fields := newDatasetFlags(flagset)
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: publish [options]\n")
+		fmt.Fprintf(flagset.Output(), "  Registers a dataset given by flags, or datasets of a file. Flags override fields of a single dataset in the file.\n")
+		flagset.PrintDefaults()
+	}
+	parseFlags(flagset, args)
+
+	datasets := []*dataset.Dataset{}
+	if len(from) > 0 {
+		var err error
+		datasets, err = catalog.ReadDatasetFile(from)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if len(datasets) > 1 && fields.isSet(flagset) {
+			log.Fatalf("flags cannot be applied to %d datasets of %s", len(datasets), from)
+		}
+	}
+
+	if len(datasets) == 0 {
+		if !fields.isSet(flagset) {
+			flagset.Usage()
+			os.Exit(2)
+		}
+		datasets = append(datasets, &dataset.Dataset{})
+	}
+
+	for _, ds := range datasets {
+		fields.apply(flagset, ds)
+
+		// catalogs assign IDs to new datasets
+		ds.ID = 0
+
+		err := validateDataset(ds)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	_, publisher, err := newPublisher(catalogName)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	results := []*publishResult{}
+	for _, ds := range datasets {
+		result := &publishResult{
+			dataset: ds,
+		}
+		results = append(results, result)
+
+		if ctx.Err() != nil {
+			result.err = ctx.Err()
+			continue
+		}
+
+		published, err := publisher.CreateDataset(ctx, ds)
+		if err != nil {
+			if len(datasets) == 1 {
+				exitWithError(err)
+			}
+
+			result.err = err
+			log.Printf("Could not publish dataset %s - %v\n", ds.Name, err)
+			continue
+		}
+
+		if len(catalogName) > 0 {
+			published.Tags = copyTags(published.Tags)
+			published.Tags[catalog.SourceCatalogTag] = catalogName
+		}
+		result.published = published
+		fmt.Printf("Published dataset [%s] %s\n", catalog.GetDatasetRef(published), published.Name)
+	}
+
+	if printPublishResults(results) > 0 {
+		os.Exit(exitCodeError)
+	}
+}
+
+// publishResult is an outcome of publishing a dataset
+type publishResult struct {
+	dataset   *dataset.Dataset
+	published *dataset.Dataset
+	err       error
+}
+
+// printPublishResults prints which datasets are published if any failed, and returns the number of failed datasets
+func printPublishResults(results []*publishResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+		}
+	}
+
+	if failed == 0 {
+		return 0
+	}
+
+	log.Printf("Published %d of %d datasets, failed datasets are not published:\n", len(results)-failed, len(results))
+	for _, result := range results {
+		if result.err != nil {
+			log.Printf("  %s: failed - %v\n", result.dataset.Name, result.err)
+			continue
+		}
+		log.Printf("  [%s] %s: published\n", catalog.GetDatasetRef(result.published), result.published.Name)
+	}
+	return failed
+}
+
+func editHandler(ctx context.Context, args []string) {
+	var from string
+	untags := stringFlags{}
+
+	flagset := flag.NewFlagSet("edit", flag.ExitOnError)
+	flagset.StringVar(&from, "from", "", "Replace the dataset with the one in a JSON or YAML file")
+	flagset.Var(&untags, "untag", "Remove a tag of the dataset, can be repeated")
+	fields := newDatasetFlags(flagset)
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: edit [options] <id>\n")
+		fmt.Fprintf(flagset.Output(), "  Changes fields given by flags, other fields are kept.\n")
+		flagset.PrintDefaults()
+	}
+	refs := parseFlags(flagset, args)
+
+	if len(refs) != 1 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	catalogName, id := catalog.ParseDatasetRef(refs[0])
+	datasetID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		log.Fatalf("invalid dataset id - %s", id)
+	}
+
+	client, publisher, err := newPublisher(catalogName)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	ds, err := client.GetDataset(ctx, id)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if len(from) > 0 {
+		ds, err = readSingleDataset(from)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if ds.ID != 0 && ds.ID != datasetID {
+			log.Fatalf("dataset in %s has id %d, not %d", from, ds.ID, datasetID)
+		}
+	}
+
+	ds.ID = datasetID
+	ds.Tags = copyTags(ds.Tags)
+	fields.apply(flagset, ds)
+	for _, k := range untags {
+		delete(ds.Tags, k)
+	}
+
+	err = validateDataset(ds)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	updated, err := publisher.UpdateDataset(ctx, ds)
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Printf("Updated dataset [%s] %s\n", refs[0], updated.Name)
+}
+
+func retractHandler(ctx context.Context, args []string) {
+	var yes bool
+
+	flagset := flag.NewFlagSet("retract", flag.ExitOnError)
+	flagset.BoolVar(&yes, "yes", false, "Retract without confirmation")
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: retract [options] <id>...\n")
+		flagset.PrintDefaults()
+	}
+	refs := parseFlags(flagset, args)
+
+	if len(refs) == 0 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	// catalogs are checked before retracting any dataset
+	clients := map[string]catalog.Catalog{}
+	publishers := map[string]catalog.Publisher{}
+	for _, ref := range refs {
+		catalogName, _ := catalog.ParseDatasetRef(ref)
+		if _, ok := clients[catalogName]; ok {
+			continue
+		}
+
+		client, publisher, err := newPublisher(catalogName)
+		if err != nil {
+			exitWithError(err)
+		}
+		clients[catalogName] = client
+		publishers[catalogName] = publisher
+	}
+
+	for _, ref := range refs {
+		catalogName, id := catalog.ParseDatasetRef(ref)
+		client := clients[catalogName]
+		publisher := publishers[catalogName]
+
+		ds, err := client.GetDataset(ctx, id)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if !yes {
+			confirmed, err := confirmRetract(ref, ds)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if !confirmed {
+				fmt.Printf("Dataset [%s] is kept\n", ref)
+				continue
+			}
+		}
+
+		err = publisher.DeleteDataset(ctx, id)
+		if err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("Retracted dataset [%s] %s\n", ref, ds.Name)
+	}
+}
+
+// confirmRetract asks whether to retract the dataset
+func confirmRetract(ref string, ds *dataset.Dataset) (bool, error) {
+	if !isTerminal(os.Stdin) {
+		return false, fmt.Errorf("retracting a dataset requires confirmation, give -yes to retract without confirmation")
+	}
+
+	fmt.Fprintf(os.Stderr, "Retract dataset [%s] %s? [y/N] ", ref, ds.Name)
+
+	reader := bufio.NewReader(os.Stdin)
+	line, err := reader.ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return false, err
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes", nil
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	tagsCopy := map[string]string{}
+	for k, v := range tags {
+		tagsCopy[k] = v
+	}
+	return tagsCopy
+}
@@ -10,9 +10,11 @@ require (
 	github.com/iychoi/parcel-catalog-service v0.0.0-20201023193515-f2d77a6f91d4
 	github.com/lithammer/shortuuid/v3 v3.0.4
 	github.com/tkanos/gonfig v0.0.0-20181112185242-896f3d81fadf
+	golang.org/x/net v0.0.0-20200513185701-a91f0712d120
 	google.golang.org/appengine v1.6.1 // indirect
 	k8s.io/api v0.17.0
 	k8s.io/apimachinery v0.17.0
 	k8s.io/client-go v0.17.0
 	k8s.io/utils v0.0.0-20201015054608-420da100c033 // indirect
+	sigs.k8s.io/yaml v1.1.0
 )
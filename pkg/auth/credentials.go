@@ -0,0 +1,206 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/homedir"
+)
+
+const (
+	// expiryDelta refreshes tokens a bit before they actually expire
+	expiryDelta = 30 * time.Second
+)
+
+// Credentials holds a token issued for a catalog service
+type Credentials struct {
+	CatalogServiceURL string    `json:"catalogServiceURL"`
+	AccessToken       string    `json:"accessToken"`
+	RefreshToken      string    `json:"refreshToken,omitempty"`
+	Expiry            time.Time `json:"expiry,omitempty"`
+	Issuer            string    `json:"issuer,omitempty"`
+	ClientID          string    `json:"clientID,omitempty"`
+	TokenEndpoint     string    `json:"tokenEndpoint,omitempty"`
+}
+
+// IsExpired checks if the access token is expired or about to expire
+func (creds *Credentials) IsExpired() bool {
+	if creds.Expiry.IsZero() {
+		return false
+	}
+	return time.Now().Add(expiryDelta).After(creds.Expiry)
+}
+
+// CanRefresh checks if the access token can be refreshed without user interaction
+func (creds *Credentials) CanRefresh() bool {
+	return len(creds.RefreshToken) > 0 && len(creds.TokenEndpoint) > 0
+}
+
+// CredentialStore keeps credentials of catalog services in a user-private file
+type CredentialStore struct {
+	path        string
+	credentials map[string]*Credentials
+	mutex       sync.Mutex
+}
+
+// GetDefaultCredentialsPath returns a credentials file path under home
+func GetDefaultCredentialsPath() (string, error) {
+	home := homedir.HomeDir()
+
+	if home != "" {
+		return filepath.Join(home, ".parcel", "credentials"), nil
+	}
+	return "", fmt.Errorf("cannot get home directory path")
+}
+
+// LoadCredentialStore reads credentials from the given file, a missing file gives an empty store
+func LoadCredentialStore(path string) (*CredentialStore, error) {
+	store := &CredentialStore{
+		path:        path,
+		credentials: map[string]*Credentials{},
+	}
+
+	jsonBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, err
+	}
+
+	credentialList := []*Credentials{}
+	err = json.Unmarshal(jsonBytes, &credentialList)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse credentials file %s - %v", path, err)
+	}
+
+	for _, creds := range credentialList {
+		store.credentials[creds.CatalogServiceURL] = creds
+	}
+	return store, nil
+}
+
+// Get returns credentials for the catalog service, or nil if there are none
+func (store *CredentialStore) Get(catalogServiceURL string) *Credentials {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	creds, ok := store.credentials[catalogServiceURL]
+	if !ok {
+		return nil
+	}
+
+	// return a copy not to be modified concurrently
+	credsCopy := *creds
+	return &credsCopy
+}
+
+// Set saves credentials of a catalog service to the file
+func (store *CredentialStore) Set(creds *Credentials) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	credsCopy := *creds
+	store.credentials[creds.CatalogServiceURL] = &credsCopy
+	return store.save()
+}
+
+// Delete removes credentials of a catalog service from the file
+func (store *CredentialStore) Delete(catalogServiceURL string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.credentials, catalogServiceURL)
+	return store.save()
+}
+
+func (store *CredentialStore) save() error {
+	err := os.MkdirAll(filepath.Dir(store.path), 0700)
+	if err != nil {
+		return err
+	}
+
+	credentialList := []*Credentials{}
+	for _, creds := range store.credentials {
+		credentialList = append(credentialList, creds)
+	}
+
+	jsonBytes, err := json.MarshalIndent(credentialList, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// the file holds secrets, keep it readable by the user only
+	tempPath := fmt.Sprintf("%s.tmp", store.path)
+	err = ioutil.WriteFile(tempPath, jsonBytes, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempPath, store.path)
+}
+
+// StoreTokenSource provides access tokens of a catalog service from a credential store
+// Expired tokens are refreshed and saved back to the store
+type StoreTokenSource struct {
+	store             *CredentialStore
+	catalogServiceURL string
+	mutex             sync.Mutex
+}
+
+// NewStoreTokenSource returns a token source for the catalog service
+func NewStoreTokenSource(store *CredentialStore, catalogServiceURL string) *StoreTokenSource {
+	return &StoreTokenSource{
+		store:             store,
+		catalogServiceURL: catalogServiceURL,
+	}
+}
+
+// Token returns an access token, or an empty string if there are no credentials
+func (source *StoreTokenSource) Token(ctx context.Context) (string, error) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	creds := source.store.Get(source.catalogServiceURL)
+	if creds == nil {
+		return "", nil
+	}
+
+	if !creds.IsExpired() {
+		return creds.AccessToken, nil
+	}
+
+	if !creds.CanRefresh() {
+		return "", fmt.Errorf("access token for %s expired at %s, run 'parcel login' again", source.catalogServiceURL, creds.Expiry.Format(time.RFC3339))
+	}
+
+	token, err := RefreshToken(ctx, creds.TokenEndpoint, creds.ClientID, creds.RefreshToken)
+	if err != nil {
+		return "", fmt.Errorf("could not refresh access token for %s, run 'parcel login' again - %v", source.catalogServiceURL, err)
+	}
+
+	token.apply(creds)
+	err = source.store.Set(creds)
+	if err != nil {
+		return "", err
+	}
+	return creds.AccessToken, nil
+}
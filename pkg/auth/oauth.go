@@ -0,0 +1,246 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	deviceCodeGrantType   = "urn:ietf:params:oauth:grant-type:device_code"
+	refreshTokenGrantType = "refresh_token"
+
+	// defaultPollInterval is used when the issuer does not give a polling interval
+	defaultPollInterval = 5 * time.Second
+	slowDownInterval    = 5 * time.Second
+)
+
+// IssuerMetadata holds endpoints of an OAuth2 issuer
+type IssuerMetadata struct {
+	Issuer                      string `json:"issuer"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+}
+
+// DeviceAuthorization is a response of a device authorization request
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// Token is a response of a token request
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// tokenError is an error response of a token request
+type tokenError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *tokenError) Error() string {
+	if len(e.Description) > 0 {
+		return fmt.Sprintf("%s: %s", e.Code, e.Description)
+	}
+	return e.Code
+}
+
+// apply updates credentials with the token
+func (token *Token) apply(creds *Credentials) {
+	creds.AccessToken = token.AccessToken
+	if len(token.RefreshToken) > 0 {
+		creds.RefreshToken = token.RefreshToken
+	}
+
+	if token.ExpiresIn > 0 {
+		creds.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	} else {
+		creds.Expiry = time.Time{}
+	}
+}
+
+// DeviceFlow runs an OAuth2 device authorization grant (RFC 8628) against an issuer
+type DeviceFlow struct {
+	Issuer   string
+	ClientID string
+	Scopes   []string
+
+	metadata *IssuerMetadata
+}
+
+// NewDeviceFlow returns a new device flow
+func NewDeviceFlow(issuer string, clientID string, scopes []string) *DeviceFlow {
+	return &DeviceFlow{
+		Issuer:   issuer,
+		ClientID: clientID,
+		Scopes:   scopes,
+	}
+}
+
+// DiscoverIssuer reads endpoints of the issuer from its well-known metadata
+func DiscoverIssuer(ctx context.Context, issuer string) (*IssuerMetadata, error) {
+	root := strings.TrimRight(issuer, "/")
+	wellKnownPaths := []string{
+		"/.well-known/openid-configuration",
+		"/.well-known/oauth-authorization-server",
+	}
+
+	var lastErr error
+	for _, wellKnownPath := range wellKnownPaths {
+		metadata := IssuerMetadata{}
+		resp, err := resty.New().R().SetContext(ctx).SetResult(&metadata).Get(root + wellKnownPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.IsError() {
+			lastErr = fmt.Errorf("could not read issuer metadata from %s - %s", resp.Request.URL, resp.Status())
+			continue
+		}
+
+		if len(metadata.DeviceAuthorizationEndpoint) == 0 || len(metadata.TokenEndpoint) == 0 {
+			return nil, fmt.Errorf("issuer %s does not support device authorization", issuer)
+		}
+		return &metadata, nil
+	}
+	return nil, lastErr
+}
+
+// Start requests a device code and returns a user code to be entered at the verification URI
+func (flow *DeviceFlow) Start(ctx context.Context) (*DeviceAuthorization, error) {
+	if flow.metadata == nil {
+		metadata, err := DiscoverIssuer(ctx, flow.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		flow.metadata = metadata
+	}
+
+	authorization := DeviceAuthorization{}
+	resp, err := resty.New().R().SetContext(ctx).
+		SetFormData(map[string]string{
+			"client_id": flow.ClientID,
+			"scope":     strings.Join(flow.Scopes, " "),
+		}).
+		SetResult(&authorization).
+		Post(flow.metadata.DeviceAuthorizationEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.IsError() {
+		return nil, parseTokenError(resp)
+	}
+	return &authorization, nil
+}
+
+// Wait polls the issuer until the user approves the authorization, and returns credentials
+func (flow *DeviceFlow) Wait(ctx context.Context, authorization *DeviceAuthorization) (*Credentials, error) {
+	interval := defaultPollInterval
+	if authorization.Interval > 0 {
+		interval = time.Duration(authorization.Interval) * time.Second
+	}
+
+	deadline := time.Now().Add(time.Duration(authorization.ExpiresIn) * time.Second)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		if authorization.ExpiresIn > 0 && time.Now().After(deadline) {
+			return nil, fmt.Errorf("device code expired before the authorization was approved")
+		}
+
+		token, err := requestToken(ctx, flow.metadata.TokenEndpoint, map[string]string{
+			"grant_type":  deviceCodeGrantType,
+			"device_code": authorization.DeviceCode,
+			"client_id":   flow.ClientID,
+		})
+		if err != nil {
+			if tokenErr, ok := err.(*tokenError); ok {
+				switch tokenErr.Code {
+				case "authorization_pending":
+					continue
+				case "slow_down":
+					interval += slowDownInterval
+					continue
+				}
+			}
+			return nil, err
+		}
+
+		creds := &Credentials{
+			Issuer:        flow.Issuer,
+			ClientID:      flow.ClientID,
+			TokenEndpoint: flow.metadata.TokenEndpoint,
+		}
+		token.apply(creds)
+		return creds, nil
+	}
+}
+
+// RefreshToken requests a new access token with a refresh token
+func RefreshToken(ctx context.Context, tokenEndpoint string, clientID string, refreshToken string) (*Token, error) {
+	return requestToken(ctx, tokenEndpoint, map[string]string{
+		"grant_type":    refreshTokenGrantType,
+		"refresh_token": refreshToken,
+		"client_id":     clientID,
+	})
+}
+
+func requestToken(ctx context.Context, tokenEndpoint string, form map[string]string) (*Token, error) {
+	token := Token{}
+	resp, err := resty.New().R().SetContext(ctx).
+		SetFormData(form).
+		SetResult(&token).
+		Post(tokenEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.IsError() {
+		return nil, parseTokenError(resp)
+	}
+
+	if len(token.AccessToken) == 0 {
+		return nil, fmt.Errorf("token response from %s has no access token", tokenEndpoint)
+	}
+	return &token, nil
+}
+
+func parseTokenError(resp *resty.Response) error {
+	tokenErr := tokenError{}
+	err := json.Unmarshal(resp.Body(), &tokenErr)
+	if err != nil || len(tokenErr.Code) == 0 {
+		return fmt.Errorf("request to %s failed - %s", resp.Request.URL, resp.Status())
+	}
+	return &tokenErr
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package catalog
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+)
+
+const (
+	// CacheTTL is a default time-to-live of a cached catalog
+	CacheTTL = 10 * time.Minute
+)
+
+// DatasetCache stores snapshots of the dataset list on disk
+type DatasetCache struct {
+	dir string
+	ttl time.Duration
+}
+
+// datasetSnapshot is a cached response of the dataset list
+type datasetSnapshot struct {
+	URL          string             `json:"url"`
+	ETag         string             `json:"etag"`
+	LastModified string             `json:"lastModified"`
+	FetchedAt    time.Time          `json:"fetchedAt"`
+	Datasets     []*dataset.Dataset `json:"datasets"`
+}
+
+// GetDefaultCacheDir returns a cache directory path under the user's cache directory
+func GetDefaultCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "parcel"), nil
+}
+
+// NewDatasetCache returns a new dataset cache stored in the given directory
+func NewDatasetCache(dir string, ttl time.Duration) *DatasetCache {
+	return &DatasetCache{
+		dir: dir,
+		ttl: ttl,
+	}
+}
+
+func (cache *DatasetCache) makeSnapshotPath(url string) string {
+	hash := sha1.Sum([]byte(url))
+	return filepath.Join(cache.dir, fmt.Sprintf("datasets-%s.json", hex.EncodeToString(hash[:])))
+}
+
+// load returns a snapshot of the given URL, or nil if there is no snapshot
+func (cache *DatasetCache) load(url string) (*datasetSnapshot, error) {
+	jsonBytes, err := ioutil.ReadFile(cache.makeSnapshotPath(url))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	snapshot := datasetSnapshot{}
+	err = json.Unmarshal(jsonBytes, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	if snapshot.URL != url {
+		return nil, nil
+	}
+	return &snapshot, nil
+}
+
+func (cache *DatasetCache) save(snapshot *datasetSnapshot) error {
+	err := os.MkdirAll(cache.dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	jsonBytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	// write to a temp file first not to leave a broken snapshot
+	snapshotPath := cache.makeSnapshotPath(snapshot.URL)
+	tempPath := fmt.Sprintf("%s.tmp", snapshotPath)
+	err = ioutil.WriteFile(tempPath, jsonBytes, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempPath, snapshotPath)
+}
+
+func (cache *DatasetCache) isFresh(snapshot *datasetSnapshot) bool {
+	return time.Since(snapshot.FetchedAt) < cache.ttl
+}
+
+// remove removes a snapshot of the given URL
+func (cache *DatasetCache) remove(url string) error {
+	err := os.Remove(cache.makeSnapshotPath(url))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
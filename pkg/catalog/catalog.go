@@ -0,0 +1,195 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"github.com/iychoi/parcel/pkg/query"
+)
+
+// Catalog provides datasets
+type Catalog interface {
+	// GetAllDatasets returns all datasets
+	GetAllDatasets(ctx context.Context) ([]*dataset.Dataset, error)
+	// IterateDatasets returns an iterator over datasets starting from offset, a limit of 0 or less means no limit
+	IterateDatasets(ctx context.Context, offset int, limit int) DatasetIterator
+	// SearchDatasets returns datasets containing any of the keywords
+	SearchDatasets(ctx context.Context, keywords []string, options *SearchOptions) ([]*dataset.Dataset, error)
+	// SelectDatasets returns datasets with specific IDs
+	SelectDatasets(ctx context.Context, ids []string) ([]*dataset.Dataset, error)
+	// GetDataset returns a dataset with the ID, or an error wrapping ErrDatasetNotFound
+	GetDataset(ctx context.Context, id string) (*dataset.Dataset, error)
+}
+
+// NewCatalog returns a catalog for the URL
+// file:// URLs give a FileCatalog, others give a ParcelCatalogServiceClient
+func NewCatalog(catalogURL string, options *ClientOptions) (Catalog, error) {
+	u, err := url.Parse(catalogURL)
+	if err == nil && strings.ToLower(u.Scheme) == "file" {
+		return NewFileCatalog(getFilePath(u))
+	}
+
+	return NewCatalogServiceClient(catalogURL, options)
+}
+
+// getFilePath returns a local path of a file URL
+// Both file:///abs/path and file://relative/path are accepted
+func getFilePath(u *url.URL) string {
+	host := u.Host
+	if host == "localhost" {
+		host = ""
+	}
+
+	path := u.Path
+	if len(u.Opaque) > 0 {
+		path = u.Opaque
+	}
+	return filepath.FromSlash(host + path)
+}
+
+// QueryDatasets returns datasets of the catalog matching the query, the most relevant first
+// Plain keywords of the query are sent to the catalog to narrow down datasets, the rest is applied locally
+// Sort in options overrides the relevance order
+func QueryDatasets(ctx context.Context, catalog Catalog, q *query.Query, options *SearchOptions) ([]*dataset.Dataset, error) {
+	if options == nil {
+		options = &SearchOptions{}
+	}
+
+	var candidates []*dataset.Dataset
+	var err error
+	if keywords := q.Keywords(); len(keywords) > 0 {
+		candidates, err = catalog.SearchDatasets(ctx, keywords, nil)
+	} else {
+		candidates, err = catalog.GetAllDatasets(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	foundDatasets := []*dataset.Dataset{}
+	for _, scored := range q.Rank(candidates) {
+		foundDatasets = append(foundDatasets, scored.Dataset)
+	}
+
+	err = sortDatasets(foundDatasets, options.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	return pageDatasets(foundDatasets, options.Page, options.Limit), nil
+}
+
+func searchDatasets(datasets []*dataset.Dataset, keywords []string, options *SearchOptions) ([]*dataset.Dataset, error) {
+	if options == nil {
+		options = &SearchOptions{}
+	}
+
+	foundDatasets := []*dataset.Dataset{}
+	for _, ds := range datasets {
+		if ds.ContainsKeywords(keywords) {
+			foundDatasets = append(foundDatasets, ds)
+		}
+	}
+
+	err := sortDatasets(foundDatasets, options.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	return pageDatasets(foundDatasets, options.Page, options.Limit), nil
+}
+
+func selectDatasets(datasets []*dataset.Dataset, ids []string) []*dataset.Dataset {
+	foundDatasets := []*dataset.Dataset{}
+	for _, ds := range datasets {
+		for _, id := range ids {
+			if strconv.FormatInt(ds.ID, 10) == id {
+				// found
+				foundDatasets = append(foundDatasets, ds)
+				break
+			}
+		}
+	}
+	return foundDatasets
+}
+
+func findDataset(datasets []*dataset.Dataset, id string) (*dataset.Dataset, error) {
+	for _, ds := range datasets {
+		if strconv.FormatInt(ds.ID, 10) == id {
+			return ds, nil
+		}
+	}
+	return nil, fmt.Errorf("%w - %s", ErrDatasetNotFound, id)
+}
+
+func sortDatasets(datasets []*dataset.Dataset, sortBy string) error {
+	if len(sortBy) == 0 {
+		return nil
+	}
+
+	descending := strings.HasPrefix(sortBy, "-")
+	field := strings.ToLower(strings.TrimPrefix(sortBy, "-"))
+
+	var less func(i int, j int) bool
+	switch field {
+	case SortByID:
+		less = func(i int, j int) bool {
+			return datasets[i].ID < datasets[j].ID
+		}
+	case SortByName:
+		less = func(i int, j int) bool {
+			return strings.ToLower(datasets[i].Name) < strings.ToLower(datasets[j].Name)
+		}
+	default:
+		return fmt.Errorf("unknown sort field - %s", field)
+	}
+
+	if descending {
+		sort.SliceStable(datasets, func(i int, j int) bool {
+			return less(j, i)
+		})
+	} else {
+		sort.SliceStable(datasets, less)
+	}
+	return nil
+}
+
+func pageDatasets(datasets []*dataset.Dataset, page int, limit int) []*dataset.Dataset {
+	if limit <= 0 {
+		return datasets
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	start := (page - 1) * limit
+	if start >= len(datasets) {
+		return []*dataset.Dataset{}
+	}
+
+	end := start + limit
+	if end > len(datasets) {
+		end = len(datasets)
+	}
+	return datasets[start:end]
+}
@@ -14,10 +14,16 @@ limitations under the License.
 package catalog
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
@@ -29,36 +35,188 @@ const (
 
 	// ShortDescriptionLen is the short description max length
 	ShortDescriptionLen = 200
+
+	// SortByID sorts search results by dataset ID
+	SortByID = "id"
+	// SortByName sorts search results by dataset name
+	SortByName = "name"
+
+	// DefaultTimeout is a default timeout of a request
+	DefaultTimeout = 30 * time.Second
+	// DefaultRetries is a default number of retries of a failed GET request
+	DefaultRetries = 3
+
+	retryWaitTime    = 1 * time.Second
+	retryMaxWaitTime = 30 * time.Second
 )
 
-// ParcelCatalogServiceClient is a client for catalog service
+// SearchOptions holds paging and sort parameters for a search
+// Page starts from 1, a Limit of 0 means no limit
+// Sort is a field name (id or name), prefixed with "-" for a descending order
+type SearchOptions struct {
+	Page  int
+	Limit int
+	Sort  string
+}
+
+// TokenSource provides bearer tokens attached to requests
+// An empty token sends the request anonymously
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// ClientOptions holds optional settings for ParcelCatalogServiceClient
+type ClientOptions struct {
+	// Trace traces communication with catalog service
+	Trace bool
+	// Cache stores the dataset list on disk, nil disables caching
+	Cache *DatasetCache
+	// Refresh revalidates the cached dataset list even if it is still fresh
+	Refresh bool
+	// Offline uses the cached dataset list only, without contacting catalog service
+	Offline bool
+	// Timeout limits each request including reading its response, 0 means no timeout
+	Timeout time.Duration
+	// Retries is the number of retries of a GET request failed with a connection error or 5xx status
+	Retries int
+	// TokenSource provides bearer tokens for authenticated access, nil for anonymous access
+	TokenSource TokenSource
+}
+
+// ParcelCatalogServiceClient is a client for catalog service, implementing Catalog
 type ParcelCatalogServiceClient struct {
 	catalogServiceURL string
 	trace             bool
-	restClient        *resty.Request
+	cache             *DatasetCache
+	refresh           bool
+	offline           bool
+	restClient        *resty.Client
+
+	discoveryOnce sync.Once
+	serverInfo    *ServerInfo
+	discoveryErr  error
 }
 
 // NewCatalogServiceClient creates a new ParcelCatalogServiceClient
-func NewCatalogServiceClient(CatalogServiceURL string, trace bool) (*ParcelCatalogServiceClient, error) {
+func NewCatalogServiceClient(catalogServiceURL string, options *ClientOptions) (*ParcelCatalogServiceClient, error) {
 	serviceURL := CatalogServiceURL
-	if len(CatalogServiceURL) > 0 {
-		serviceURL = CatalogServiceURL
+	if len(catalogServiceURL) > 0 {
+		serviceURL = catalogServiceURL
+	}
+
+	if options == nil {
+		options = &ClientOptions{}
+	}
+
+	if options.Offline && options.Cache == nil {
+		return nil, fmt.Errorf("offline mode requires a catalog cache")
 	}
 
 	return &ParcelCatalogServiceClient{
 		catalogServiceURL: serviceURL,
-		restClient:        getRestClient(trace),
-		trace:             trace,
+		restClient:        getRestClient(options),
+		trace:             options.Trace,
+		cache:             options.Cache,
+		refresh:           options.Refresh,
+		offline:           options.Offline,
 	}, nil
 }
 
-func getRestClient(trace bool) *resty.Request {
-	restClient := resty.New()
-	req := restClient.R()
-	if trace {
-		req = req.EnableTrace()
+// restLogger passes resty logs, such as failed attempts, only when tracing
+type restLogger struct {
+	trace bool
+}
+
+func (logger *restLogger) Errorf(format string, v ...interface{}) {
+	logger.printf(format, v...)
+}
+
+func (logger *restLogger) Warnf(format string, v ...interface{}) {
+	logger.printf(format, v...)
+}
+
+func (logger *restLogger) Debugf(format string, v ...interface{}) {
+	logger.printf(format, v...)
+}
+
+func (logger *restLogger) printf(format string, v ...interface{}) {
+	if logger.trace {
+		log.Printf(format, v...)
+	}
+}
+
+func getRestClient(options *ClientOptions) *resty.Client {
+	restClient := resty.New().SetLogger(&restLogger{trace: options.Trace})
+	if options.Trace {
+		restClient = restClient.EnableTrace()
+	}
+
+	if options.Timeout > 0 {
+		restClient = restClient.SetTimeout(options.Timeout)
+	}
+
+	if options.Retries > 0 {
+		// retries back off exponentially from retryWaitTime up to retryMaxWaitTime
+		restClient = restClient.
+			SetRetryCount(options.Retries).
+			SetRetryWaitTime(retryWaitTime).
+			SetRetryMaxWaitTime(retryMaxWaitTime).
+			AddRetryCondition(isRetryable)
+	}
+
+	if options.TokenSource != nil {
+		tokenSource := options.TokenSource
+		restClient = restClient.OnBeforeRequest(func(c *resty.Client, req *resty.Request) error {
+			// called on every attempt, so that an expired token is refreshed between retries
+			token, err := tokenSource.Token(req.Context())
+			if err != nil {
+				return err
+			}
+
+			if len(token) > 0 {
+				req.SetAuthToken(token)
+			}
+			return nil
+		})
+	}
+	return restClient
+}
+
+// streamingRequestKey marks contexts of requests whose responses are streamed
+type streamingRequestKey struct{}
+
+// withStreaming returns a context for a request whose response body is streamed
+// Streamed responses are retried only on connection errors, as resty neither reads nor closes bodies of discarded attempts
+func withStreaming(ctx context.Context) context.Context {
+	return context.WithValue(ctx, streamingRequestKey{}, true)
+}
+
+// isRetryable checks if a request can be retried
+// Only idempotent GET requests failed with a connection error or 5xx status are retried
+func isRetryable(resp *resty.Response, err error) bool {
+	if resp == nil || resp.Request == nil {
+		return false
+	}
+
+	if resp.Request.Method != resty.MethodGet {
+		return false
+	}
+
+	if resp.Request.Context().Err() != nil {
+		// cancelled or timed out by the caller
+		return false
 	}
-	return req
+
+	if err != nil {
+		return true
+	}
+
+	if resp.Request.Context().Value(streamingRequestKey{}) != nil {
+		// the body of the response would be leaked
+		return false
+	}
+
+	return resp.StatusCode() >= http.StatusInternalServerError
 }
 
 func traceResponse(trace bool, resp *resty.Response, err error) {
@@ -90,67 +248,256 @@ func traceResponse(trace bool, resp *resty.Response, err error) {
 	}
 }
 
-func (client *ParcelCatalogServiceClient) get(url string) (*resty.Response, error) {
-	resp, err := client.restClient.Get(url)
+// newRequest returns a new request bound to the context
+func (client *ParcelCatalogServiceClient) newRequest(ctx context.Context) *resty.Request {
+	return client.restClient.R().SetContext(ctx)
+}
+
+func (client *ParcelCatalogServiceClient) get(ctx context.Context, url string) (*resty.Response, error) {
+	return client.getWithQuery(ctx, url, nil)
+}
+
+func (client *ParcelCatalogServiceClient) getWithQuery(ctx context.Context, url string, query map[string][]string) (*resty.Response, error) {
+	req := client.newRequest(ctx)
+	if query != nil {
+		req = req.SetQueryParamsFromValues(query)
+	}
+
+	resp, err := req.Get(url)
 	traceResponse(client.trace, resp, err)
 	return resp, err
 }
 
 // GetAllDatasets returns all datasets
-func (client *ParcelCatalogServiceClient) GetAllDatasets() ([]*dataset.Dataset, error) {
-	requestURL := makeRequestPath(CatalogServiceURL, "/datasets")
+// If a cache is configured, a fresh snapshot is used without contacting catalog service,
+// and a stale one is revalidated with a conditional request
+func (client *ParcelCatalogServiceClient) GetAllDatasets(ctx context.Context) ([]*dataset.Dataset, error) {
+	if client.cache == nil {
+		return client.fetchAllDatasets(ctx)
+	}
+
+	snapshot, err := client.cache.load(client.catalogServiceURL)
+	if err != nil {
+		log.Printf("Could not read cached catalog - %v", err)
+		snapshot = nil
+	}
+
+	if client.offline {
+		if snapshot == nil {
+			return nil, fmt.Errorf("no cached catalog of %s is available offline", client.catalogServiceURL)
+		}
+		return snapshot.Datasets, nil
+	}
+
+	if snapshot != nil && !client.refresh && client.cache.isFresh(snapshot) {
+		return snapshot.Datasets, nil
+	}
+
+	requestURL := client.makeListURL(ctx)
+
+	req := client.newRequest(ctx)
+	if snapshot != nil {
+		if len(snapshot.ETag) > 0 {
+			req = req.SetHeader("If-None-Match", snapshot.ETag)
+		}
+		if len(snapshot.LastModified) > 0 {
+			req = req.SetHeader("If-Modified-Since", snapshot.LastModified)
+		}
+	}
+
+	resp, err := req.Get(requestURL)
+	traceResponse(client.trace, resp, err)
+	if err != nil {
+		if snapshot != nil && ctx.Err() == nil {
+			log.Printf("Catalog service is unreachable, using catalog cached at %s", snapshot.FetchedAt.Format(time.RFC3339))
+			return snapshot.Datasets, nil
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode() == http.StatusNotModified && snapshot != nil {
+		snapshot.FetchedAt = time.Now()
+	} else {
+		err = checkResponse(resp)
+		if err != nil {
+			if snapshot != nil && errors.Is(err, ErrServer) {
+				log.Printf("Catalog service failed (%s), using catalog cached at %s", resp.Status(), snapshot.FetchedAt.Format(time.RFC3339))
+				return snapshot.Datasets, nil
+			}
+			return nil, err
+		}
+
+		datasets, err := decodeDatasets(requestURL, resp.Body())
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot = &datasetSnapshot{
+			URL:          client.catalogServiceURL,
+			ETag:         resp.Header().Get("ETag"),
+			LastModified: resp.Header().Get("Last-Modified"),
+			FetchedAt:    time.Now(),
+			Datasets:     datasets,
+		}
+	}
+
+	err = client.cache.save(snapshot)
+	if err != nil {
+		log.Printf("Could not cache catalog - %v", err)
+	}
+
+	return snapshot.Datasets, nil
+}
+
+func (client *ParcelCatalogServiceClient) fetchAllDatasets(ctx context.Context) ([]*dataset.Dataset, error) {
+	requestURL := client.makeListURL(ctx)
 
-	resp, err := client.get(requestURL)
+	resp, err := client.get(ctx, requestURL)
 	if err != nil {
 		return nil, err
 	}
 
-	body := resp.Body()
-	datasets := dataset.Listify(body)
+	err = checkResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeDatasets(requestURL, resp.Body())
+}
+
+// cachedDatasets returns cached datasets if they can be used without contacting catalog service
+// A stale snapshot is returned only if allowStale is set
+func (client *ParcelCatalogServiceClient) cachedDatasets(allowStale bool) ([]*dataset.Dataset, bool) {
+	if client.cache == nil {
+		return nil, false
+	}
+
+	snapshot, err := client.cache.load(client.catalogServiceURL)
+	if err != nil || snapshot == nil {
+		return nil, false
+	}
 
-	return datasets, nil
+	if client.offline || allowStale || (!client.refresh && client.cache.isFresh(snapshot)) {
+		return snapshot.Datasets, true
+	}
+	return nil, false
 }
 
 // SearchDatasets returns search result
-func (client *ParcelCatalogServiceClient) SearchDatasets(keywords []string) ([]*dataset.Dataset, error) {
-	// TODO: add search API to catalog service
-	// Now just do it from local
+// It uses the search endpoint of the catalog service, and filters datasets locally
+// only when the service does not provide the endpoint
+func (client *ParcelCatalogServiceClient) SearchDatasets(ctx context.Context, keywords []string, options *SearchOptions) ([]*dataset.Dataset, error) {
+	if options == nil {
+		options = &SearchOptions{}
+	}
+
+	if client.offline {
+		return client.searchDatasetsLocally(ctx, keywords, options)
+	}
+
+	requestURL, ok := client.makeEndpointURL(ctx, EndpointSearch, "")
+	if !ok {
+		return client.searchDatasetsLocally(ctx, keywords, options)
+	}
+
+	query := map[string][]string{
+		"keywords": keywords,
+	}
+	if options.Page > 0 {
+		query["page"] = []string{strconv.Itoa(options.Page)}
+	}
+	if options.Limit > 0 {
+		query["limit"] = []string{strconv.Itoa(options.Limit)}
+	}
+	if len(options.Sort) > 0 {
+		query["sort"] = []string{options.Sort}
+	}
 
-	datasets, err := client.GetAllDatasets()
+	resp, err := client.getWithQuery(ctx, requestURL, query)
 	if err != nil {
-		log.Fatal(err)
+		if _, ok := client.cachedDatasets(true); ok && ctx.Err() == nil {
+			log.Printf("Catalog service is unreachable, searching cached catalog")
+			return client.searchDatasetsLocally(ctx, keywords, options)
+		}
+		return nil, err
 	}
 
-	foundDatasets := []*dataset.Dataset{}
-	for _, ds := range datasets {
-		if ds.ContainsKeywords(keywords) {
-			foundDatasets = append(foundDatasets, ds)
+	if isEndpointMissing(resp.StatusCode()) {
+		if client.trace {
+			log.Printf("Search endpoint is not available (%s), searching locally", resp.Status())
 		}
+		return client.searchDatasetsLocally(ctx, keywords, options)
+	}
+
+	err = checkResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeDatasets(requestURL, resp.Body())
+}
+
+func (client *ParcelCatalogServiceClient) searchDatasetsLocally(ctx context.Context, keywords []string, options *SearchOptions) ([]*dataset.Dataset, error) {
+	datasets, err := client.GetAllDatasets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return searchDatasets(datasets, keywords, options)
+}
+
+// isEndpointMissing checks if the status code tells that the service does not have the endpoint
+func isEndpointMissing(statusCode int) bool {
+	switch statusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	default:
+		return false
 	}
-	return foundDatasets, nil
 }
 
 // SelectDatasets returns datasets with specific IDs
-func (client *ParcelCatalogServiceClient) SelectDatasets(ids []string) ([]*dataset.Dataset, error) {
-	// TODO: add search API to catalog service
-	// Now just do it from local
+func (client *ParcelCatalogServiceClient) SelectDatasets(ctx context.Context, ids []string) ([]*dataset.Dataset, error) {
+	datasets, err := client.GetAllDatasets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return selectDatasets(datasets, ids), nil
+}
+
+// GetDataset returns a dataset with the ID
+// It uses the single-dataset endpoint of the catalog service if available
+func (client *ParcelCatalogServiceClient) GetDataset(ctx context.Context, id string) (*dataset.Dataset, error) {
+	requestURL, ok := client.makeEndpointURL(ctx, EndpointGet, id)
+	if !ok || client.offline {
+		datasets, err := client.GetAllDatasets(ctx)
+		if err != nil {
+			return nil, err
+		}
 
-	datasets, err := client.GetAllDatasets()
+		return findDataset(datasets, id)
+	}
+
+	resp, err := client.get(ctx, requestURL)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	foundDatasets := []*dataset.Dataset{}
-	for _, ds := range datasets {
-		for _, id := range ids {
-			if strconv.FormatInt(ds.ID, 10) == id {
-				// found
-				foundDatasets = append(foundDatasets, ds)
-				break
-			}
+	err = checkResponse(resp)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w - %s", ErrDatasetNotFound, id)
 		}
+		return nil, err
+	}
+
+	ds := dataset.Dataset{}
+	err = json.Unmarshal(resp.Body(), &ds)
+	if err != nil {
+		return nil, newMalformedPayloadError(requestURL, resp.Body(), err)
 	}
-	return foundDatasets, nil
+	return &ds, nil
 }
 
 func makeRequestPath(requestRoot string, path string) string {
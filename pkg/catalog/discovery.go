@@ -0,0 +1,168 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+const (
+	// APIVersionV1 is the first version of catalog service API
+	APIVersionV1 = "v1"
+
+	// EndpointList is an endpoint listing datasets
+	EndpointList = "list"
+	// EndpointSearch is an endpoint searching datasets by keywords
+	EndpointSearch = "search"
+	// EndpointGet is an endpoint returning a single dataset, its path contains "{id}"
+	EndpointGet = "get"
+)
+
+var (
+	// SupportedAPIVersions lists API versions the client understands, most preferred first
+	SupportedAPIVersions = []string{APIVersionV1}
+
+	// legacyAPI describes catalog services that do not serve a discovery document
+	legacyAPI = APIDescription{
+		Endpoints: map[string]string{
+			EndpointList:   "/datasets",
+			EndpointSearch: "/datasets/search",
+		},
+	}
+)
+
+// APIDescription describes an API version served by catalog service
+// Endpoint paths are relative to the catalog service URL
+type APIDescription struct {
+	Version   string            `json:"version"`
+	Endpoints map[string]string `json:"endpoints"`
+	Paging    bool              `json:"paging"`
+}
+
+// DiscoveryDocument is served at the catalog service URL and describes the APIs it provides
+type DiscoveryDocument struct {
+	ServiceVersion string           `json:"serviceVersion"`
+	APIs           []APIDescription `json:"apis"`
+}
+
+// ServerInfo is the result of API discovery and version negotiation
+type ServerInfo struct {
+	URL            string          `json:"url"`
+	ServiceVersion string          `json:"serviceVersion"`
+	APIVersions    []string        `json:"apiVersions"`
+	SelectedAPI    *APIDescription `json:"selectedAPI"`
+	Legacy         bool            `json:"legacy"`
+	Compatible     bool            `json:"compatible"`
+	Message        string          `json:"message,omitempty"`
+}
+
+// GetServerInfo returns the result of API discovery and version negotiation with catalog service
+// The error describes why discovery failed, in which case legacy endpoints are used
+func (client *ParcelCatalogServiceClient) GetServerInfo(ctx context.Context) (*ServerInfo, error) {
+	client.discoveryOnce.Do(func() {
+		client.serverInfo, client.discoveryErr = client.discover(ctx)
+		if !client.serverInfo.Compatible {
+			log.Printf("Warning: %s", client.serverInfo.Message)
+		}
+	})
+	return client.serverInfo, client.discoveryErr
+}
+
+func (client *ParcelCatalogServiceClient) getAPI(ctx context.Context) *APIDescription {
+	info, err := client.GetServerInfo(ctx)
+	if err != nil && client.trace {
+		log.Printf("API discovery failed, using legacy endpoints - %v", err)
+	}
+	return info.SelectedAPI
+}
+
+func (client *ParcelCatalogServiceClient) discover(ctx context.Context) (*ServerInfo, error) {
+	legacy := legacyAPI
+	info := &ServerInfo{
+		URL:         client.catalogServiceURL,
+		SelectedAPI: &legacy,
+		Legacy:      true,
+		Compatible:  true,
+	}
+
+	if client.offline {
+		return info, nil
+	}
+
+	resp, err := client.newRequest(ctx).SetHeader("Accept", "application/json").Get(client.catalogServiceURL)
+	traceResponse(client.trace, resp, err)
+	if err != nil {
+		return info, err
+	}
+
+	err = checkResponse(resp)
+	if err != nil {
+		return info, err
+	}
+
+	doc := DiscoveryDocument{}
+	err = json.Unmarshal(resp.Body(), &doc)
+	if err != nil || len(doc.APIs) == 0 {
+		// services without discovery serve a plain root page
+		return info, nil
+	}
+
+	info.Legacy = false
+	info.ServiceVersion = doc.ServiceVersion
+	info.APIVersions = []string{}
+	for _, api := range doc.APIs {
+		info.APIVersions = append(info.APIVersions, api.Version)
+	}
+
+	for _, version := range SupportedAPIVersions {
+		for idx := range doc.APIs {
+			if doc.APIs[idx].Version == version {
+				info.SelectedAPI = &doc.APIs[idx]
+				return info, nil
+			}
+		}
+	}
+
+	info.Compatible = false
+	info.Message = fmt.Sprintf("Catalog Service at %s serves API versions %s, but the client supports %s only, using legacy endpoints", client.catalogServiceURL, strings.Join(info.APIVersions, ", "), strings.Join(SupportedAPIVersions, ", "))
+	return info, nil
+}
+
+// makeEndpointURL returns the URL of an endpoint, or false if catalog service does not provide it
+func (client *ParcelCatalogServiceClient) makeEndpointURL(ctx context.Context, endpoint string, id string) (string, bool) {
+	api := client.getAPI(ctx)
+
+	path, ok := api.Endpoints[endpoint]
+	if !ok || len(path) == 0 {
+		return "", false
+	}
+
+	if len(id) > 0 {
+		path = strings.ReplaceAll(path, "{id}", url.PathEscape(id))
+	}
+	return makeRequestPath(client.catalogServiceURL, path), true
+}
+
+func (client *ParcelCatalogServiceClient) makeListURL(ctx context.Context) string {
+	requestURL, ok := client.makeEndpointURL(ctx, EndpointList, "")
+	if !ok {
+		return makeRequestPath(client.catalogServiceURL, legacyAPI.Endpoints[EndpointList])
+	}
+	return requestURL
+}
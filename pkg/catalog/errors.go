@@ -0,0 +1,143 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+)
+
+const (
+	// bodyExcerptLen is the max length of a response body kept in errors
+	bodyExcerptLen = 200
+)
+
+var (
+	// ErrNotFound is returned when catalog service does not have the requested resource
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized is returned when catalog service rejects the credentials
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrServer is returned when catalog service fails to process a request
+	ErrServer = errors.New("server error")
+	// ErrBadRequest is returned when catalog service rejects a request
+	ErrBadRequest = errors.New("bad request")
+	// ErrMalformedPayload is returned when a response cannot be decoded
+	ErrMalformedPayload = errors.New("malformed payload")
+
+	// ErrDatasetNotFound is returned when a catalog does not have the requested dataset
+	// It wraps ErrNotFound
+	ErrDatasetNotFound = fmt.Errorf("dataset %w", ErrNotFound)
+)
+
+// ResponseError describes an error response or an undecodable payload from catalog service
+// Use errors.Is with ErrNotFound, ErrUnauthorized, ErrServer, ErrBadRequest or ErrMalformedPayload
+// to check the kind of the error
+type ResponseError struct {
+	Kind        error
+	URL         string
+	StatusCode  int
+	Status      string
+	BodyExcerpt string
+	Err         error
+}
+
+func (e *ResponseError) Error() string {
+	msg := fmt.Sprintf("%s from %s", e.Kind, e.URL)
+	if len(e.Status) > 0 {
+		msg = fmt.Sprintf("%s (status %s)", msg, e.Status)
+	}
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s - %v", msg, e.Err)
+	}
+	if len(e.BodyExcerpt) > 0 {
+		msg = fmt.Sprintf("%s: %q", msg, e.BodyExcerpt)
+	}
+	return msg
+}
+
+// Unwrap returns the kind of the error
+func (e *ResponseError) Unwrap() error {
+	return e.Kind
+}
+
+// checkResponse returns a ResponseError if the response has an error status
+func checkResponse(resp *resty.Response) error {
+	if !resp.IsError() {
+		return nil
+	}
+
+	body := resp.Body()
+	if body == nil && resp.RawBody() != nil {
+		// the response is not parsed, read only the excerpt
+		body, _ = ioutil.ReadAll(io.LimitReader(resp.RawBody(), bodyExcerptLen+1))
+		resp.RawBody().Close()
+	}
+
+	return &ResponseError{
+		Kind:        getErrorKind(resp.StatusCode()),
+		URL:         resp.Request.URL,
+		StatusCode:  resp.StatusCode(),
+		Status:      resp.Status(),
+		BodyExcerpt: makeBodyExcerpt(body),
+	}
+}
+
+func getErrorKind(statusCode int) error {
+	switch {
+	case statusCode == http.StatusNotFound:
+		return ErrNotFound
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case statusCode >= http.StatusInternalServerError:
+		return ErrServer
+	default:
+		return ErrBadRequest
+	}
+}
+
+// newMalformedPayloadError returns a ResponseError for a response that cannot be decoded
+func newMalformedPayloadError(url string, body []byte, err error) error {
+	return &ResponseError{
+		Kind:        ErrMalformedPayload,
+		URL:         url,
+		BodyExcerpt: makeBodyExcerpt(body),
+		Err:         err,
+	}
+}
+
+func makeBodyExcerpt(body []byte) string {
+	excerpt := strings.Join(strings.Fields(string(body)), " ")
+	if len(excerpt) > bodyExcerptLen {
+		return fmt.Sprintf("%s...", excerpt[:bodyExcerptLen])
+	}
+	return excerpt
+}
+
+// decodeDatasets decodes a JSON list of datasets
+func decodeDatasets(url string, body []byte) ([]*dataset.Dataset, error) {
+	datasets := []*dataset.Dataset{}
+	err := json.Unmarshal(body, &datasets)
+	if err != nil {
+		return nil, newMalformedPayloadError(url, body, err)
+	}
+	return datasets, nil
+}
@@ -0,0 +1,309 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+)
+
+const (
+	// SourceCatalogTag is a dataset tag holding the name of the catalog the dataset came from
+	// The key is reserved by parcel not to clash with tags given by catalogs
+	SourceCatalogTag = "parcel.iychoi/catalog"
+)
+
+var (
+	catalogNameRegexp = regexp.MustCompile("^[a-z0-9]([-a-z0-9]*[a-z0-9])?$")
+)
+
+// NamedCatalog is a catalog with a name used to refer to its datasets
+type NamedCatalog struct {
+	Name    string
+	Catalog Catalog
+}
+
+// FederatedCatalog merges datasets of multiple catalogs
+// Datasets are tagged with SourceCatalogTag, and referred as <catalog>/<id>
+type FederatedCatalog struct {
+	catalogs []NamedCatalog
+}
+
+// catalogResult is a result of a request to one of the federated catalogs
+type catalogResult struct {
+	datasets []*dataset.Dataset
+	err      error
+}
+
+// NewFederatedCatalog returns a catalog merging the given catalogs
+// Names must be lower case alphanumerics or '-', and unique
+func NewFederatedCatalog(catalogs []NamedCatalog) (*FederatedCatalog, error) {
+	if len(catalogs) == 0 {
+		return nil, fmt.Errorf("no catalogs are given")
+	}
+
+	names := map[string]bool{}
+	for _, namedCatalog := range catalogs {
+		if !catalogNameRegexp.MatchString(namedCatalog.Name) {
+			return nil, fmt.Errorf("invalid catalog name '%s', use lower case alphanumerics or '-'", namedCatalog.Name)
+		}
+
+		if names[namedCatalog.Name] {
+			return nil, fmt.Errorf("duplicated catalog name '%s'", namedCatalog.Name)
+		}
+		names[namedCatalog.Name] = true
+	}
+
+	return &FederatedCatalog{
+		catalogs: catalogs,
+	}, nil
+}
+
+// GetDatasetRef returns a reference to the dataset, <catalog>/<id> for datasets of a federated catalog
+func GetDatasetRef(ds *dataset.Dataset) string {
+	id := strconv.FormatInt(ds.ID, 10)
+	if catalogName, ok := ds.Tags[SourceCatalogTag]; ok && len(catalogName) > 0 {
+		return fmt.Sprintf("%s/%s", catalogName, id)
+	}
+	return id
+}
+
+// ParseDatasetRef splits a dataset reference into a catalog name and an ID
+// The catalog name is empty if the reference has an ID only
+func ParseDatasetRef(ref string) (string, string) {
+	idx := strings.Index(ref, "/")
+	if idx < 0 {
+		return "", ref
+	}
+	return ref[:idx], ref[idx+1:]
+}
+
+// tagDatasets returns copies of datasets tagged with the catalog name
+func tagDatasets(datasets []*dataset.Dataset, catalogName string) []*dataset.Dataset {
+	tagged := make([]*dataset.Dataset, 0, len(datasets))
+	for _, ds := range datasets {
+		dsCopy := *ds
+		dsCopy.Tags = map[string]string{}
+		for k, v := range ds.Tags {
+			dsCopy.Tags[k] = v
+		}
+		dsCopy.Tags[SourceCatalogTag] = catalogName
+
+		tagged = append(tagged, &dsCopy)
+	}
+	return tagged
+}
+
+// queryAll runs the query against all catalogs concurrently and merges results in the catalog order
+// Failed catalogs are reported and skipped, unless all of them fail
+func (federated *FederatedCatalog) queryAll(query func(namedCatalog NamedCatalog) ([]*dataset.Dataset, error)) ([]*dataset.Dataset, error) {
+	results := make([]catalogResult, len(federated.catalogs))
+
+	wg := sync.WaitGroup{}
+	for idx, namedCatalog := range federated.catalogs {
+		wg.Add(1)
+		go func(idx int, namedCatalog NamedCatalog) {
+			defer wg.Done()
+
+			datasets, err := query(namedCatalog)
+			if err != nil {
+				results[idx].err = err
+				return
+			}
+			results[idx].datasets = tagDatasets(datasets, namedCatalog.Name)
+		}(idx, namedCatalog)
+	}
+	wg.Wait()
+
+	merged := []*dataset.Dataset{}
+	var lastErr error
+	failed := 0
+	for idx, result := range results {
+		if result.err != nil {
+			log.Printf("Catalog '%s' failed - %v", federated.catalogs[idx].Name, result.err)
+			lastErr = result.err
+			failed++
+			continue
+		}
+		merged = append(merged, result.datasets...)
+	}
+
+	if failed == len(results) {
+		return nil, lastErr
+	}
+	return merged, nil
+}
+
+// GetCatalogs returns the federated catalogs
+func (federated *FederatedCatalog) GetCatalogs() []NamedCatalog {
+	catalogs := make([]NamedCatalog, len(federated.catalogs))
+	copy(catalogs, federated.catalogs)
+	return catalogs
+}
+
+func (federated *FederatedCatalog) getCatalog(name string) (*NamedCatalog, error) {
+	for idx := range federated.catalogs {
+		if federated.catalogs[idx].Name == name {
+			return &federated.catalogs[idx], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown catalog '%s'", name)
+}
+
+// GetAllDatasets returns datasets of all catalogs
+func (federated *FederatedCatalog) GetAllDatasets(ctx context.Context) ([]*dataset.Dataset, error) {
+	return federated.queryAll(func(namedCatalog NamedCatalog) ([]*dataset.Dataset, error) {
+		return namedCatalog.Catalog.GetAllDatasets(ctx)
+	})
+}
+
+// IterateDatasets returns an iterator over datasets of all catalogs starting from offset
+func (federated *FederatedCatalog) IterateDatasets(ctx context.Context, offset int, limit int) DatasetIterator {
+	datasets, err := federated.GetAllDatasets(ctx)
+	if err != nil {
+		return &failedDatasetIterator{err: err}
+	}
+	return newSliceDatasetIterator(datasets, offset, limit)
+}
+
+// SearchDatasets searches all catalogs and merges results
+// Paging and sort are applied to the merged results
+func (federated *FederatedCatalog) SearchDatasets(ctx context.Context, keywords []string, options *SearchOptions) ([]*dataset.Dataset, error) {
+	if options == nil {
+		options = &SearchOptions{}
+	}
+
+	// request enough datasets from each catalog to fill the page of merged results
+	catalogOptions := SearchOptions{
+		Sort: options.Sort,
+	}
+	if options.Limit > 0 {
+		page := options.Page
+		if page < 1 {
+			page = 1
+		}
+		catalogOptions.Page = 1
+		catalogOptions.Limit = page * options.Limit
+	}
+
+	datasets, err := federated.queryAll(func(namedCatalog NamedCatalog) ([]*dataset.Dataset, error) {
+		return namedCatalog.Catalog.SearchDatasets(ctx, keywords, &catalogOptions)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = sortDatasets(datasets, options.Sort)
+	if err != nil {
+		return nil, err
+	}
+	return pageDatasets(datasets, options.Page, options.Limit), nil
+}
+
+// SelectDatasets returns datasets with specific references
+// A reference is <catalog>/<id>, or an ID that must be unique among the catalogs
+func (federated *FederatedCatalog) SelectDatasets(ctx context.Context, refs []string) ([]*dataset.Dataset, error) {
+	datasets, err := federated.GetAllDatasets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	foundDatasets := []*dataset.Dataset{}
+	for _, ref := range refs {
+		matches := matchDatasetRef(datasets, ref)
+		if len(matches) > 1 {
+			return nil, newAmbiguousRefError(ref, matches)
+		}
+		foundDatasets = append(foundDatasets, matches...)
+	}
+	return foundDatasets, nil
+}
+
+// GetDataset returns a dataset with the reference
+// A reference is <catalog>/<id>, or an ID that must be unique among the catalogs
+func (federated *FederatedCatalog) GetDataset(ctx context.Context, ref string) (*dataset.Dataset, error) {
+	catalogName, id := ParseDatasetRef(ref)
+	if len(catalogName) > 0 {
+		namedCatalog, err := federated.getCatalog(catalogName)
+		if err != nil {
+			return nil, err
+		}
+
+		ds, err := namedCatalog.Catalog.GetDataset(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return tagDatasets([]*dataset.Dataset{ds}, catalogName)[0], nil
+	}
+
+	datasets, err := federated.GetAllDatasets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := matchDatasetRef(datasets, ref)
+	if len(matches) > 1 {
+		return nil, newAmbiguousRefError(ref, matches)
+	}
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w - %s", ErrDatasetNotFound, ref)
+	}
+	return matches[0], nil
+}
+
+func matchDatasetRef(datasets []*dataset.Dataset, ref string) []*dataset.Dataset {
+	catalogName, id := ParseDatasetRef(ref)
+
+	matches := []*dataset.Dataset{}
+	for _, ds := range datasets {
+		if strconv.FormatInt(ds.ID, 10) != id {
+			continue
+		}
+
+		if len(catalogName) > 0 && ds.Tags[SourceCatalogTag] != catalogName {
+			continue
+		}
+		matches = append(matches, ds)
+	}
+	return matches
+}
+
+func newAmbiguousRefError(ref string, matches []*dataset.Dataset) error {
+	refs := []string{}
+	for _, ds := range matches {
+		refs = append(refs, GetDatasetRef(ds))
+	}
+	return fmt.Errorf("dataset ID %s exists in multiple catalogs, use one of %s", ref, strings.Join(refs, ", "))
+}
+
+// failedDatasetIterator returns an error on iteration
+type failedDatasetIterator struct {
+	err error
+}
+
+func (iter *failedDatasetIterator) Next() (*dataset.Dataset, error) {
+	return nil, iter.err
+}
+
+func (iter *failedDatasetIterator) Close() error {
+	return nil
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"sigs.k8s.io/yaml"
+)
+
+// FileCatalog provides datasets read from local JSON or YAML files
+// A file may hold a list of datasets, a single dataset, or an object with a "datasets" list
+type FileCatalog struct {
+	path     string
+	datasets []*dataset.Dataset
+}
+
+// datasetFile is a file holding datasets under a "datasets" key
+type datasetFile struct {
+	Datasets []*dataset.Dataset `json:"datasets"`
+}
+
+// NewFileCatalog reads datasets from a file, or from all JSON and YAML files under a directory
+// Datasets without an ID are given one after the largest ID in the catalog
+func NewFileCatalog(path string) (*FileCatalog, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	if stat.IsDir() {
+		err = filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !info.IsDir() && isCatalogFile(filePath) {
+				files = append(files, filePath)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+	} else {
+		files = append(files, path)
+	}
+
+	datasets := []*dataset.Dataset{}
+	for _, file := range files {
+		fileDatasets, err := ReadDatasetFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		datasets = append(datasets, fileDatasets...)
+	}
+
+	err = assignDatasetIDs(datasets)
+	if err != nil {
+		return nil, fmt.Errorf("invalid catalog %s - %v", path, err)
+	}
+
+	return &FileCatalog{
+		path:     path,
+		datasets: datasets,
+	}, nil
+}
+
+func isCatalogFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
+
+// ReadDatasetFile reads datasets from a JSON or YAML file, IDs are kept as written
+func ReadDatasetFile(path string) ([]*dataset.Dataset, error) {
+	fileBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is a subset of YAML
+	jsonBytes, err := yaml.YAMLToJSON(fileBytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse catalog file %s - %v", path, err)
+	}
+
+	jsonBytes = bytes.TrimSpace(jsonBytes)
+	if len(jsonBytes) == 0 || bytes.Equal(jsonBytes, []byte("null")) {
+		return []*dataset.Dataset{}, nil
+	}
+
+	datasets := []*dataset.Dataset{}
+	switch jsonBytes[0] {
+	case '[':
+		err = json.Unmarshal(jsonBytes, &datasets)
+	case '{':
+		file := datasetFile{}
+		err = json.Unmarshal(jsonBytes, &file)
+		if err == nil && file.Datasets != nil {
+			datasets = file.Datasets
+		} else if err == nil {
+			ds := dataset.Dataset{}
+			err = json.Unmarshal(jsonBytes, &ds)
+			datasets = append(datasets, &ds)
+		}
+	default:
+		err = fmt.Errorf("expected datasets")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not parse catalog file %s - %v", path, err)
+	}
+	return datasets, nil
+}
+
+func assignDatasetIDs(datasets []*dataset.Dataset) error {
+	maxID := int64(0)
+	ids := map[int64]bool{}
+	for _, ds := range datasets {
+		if ds.ID == 0 {
+			continue
+		}
+
+		if ids[ds.ID] {
+			return fmt.Errorf("duplicated dataset ID %d", ds.ID)
+		}
+		ids[ds.ID] = true
+
+		if ds.ID > maxID {
+			maxID = ds.ID
+		}
+	}
+
+	for _, ds := range datasets {
+		if ds.ID == 0 {
+			maxID++
+			ds.ID = maxID
+		}
+	}
+	return nil
+}
+
+// GetAllDatasets returns all datasets
+func (fileCatalog *FileCatalog) GetAllDatasets(ctx context.Context) ([]*dataset.Dataset, error) {
+	return fileCatalog.datasets, nil
+}
+
+// IterateDatasets returns an iterator over datasets starting from offset
+func (fileCatalog *FileCatalog) IterateDatasets(ctx context.Context, offset int, limit int) DatasetIterator {
+	return newSliceDatasetIterator(fileCatalog.datasets, offset, limit)
+}
+
+// SearchDatasets returns datasets containing any of the keywords
+func (fileCatalog *FileCatalog) SearchDatasets(ctx context.Context, keywords []string, options *SearchOptions) ([]*dataset.Dataset, error) {
+	return searchDatasets(fileCatalog.datasets, keywords, options)
+}
+
+// SelectDatasets returns datasets with specific IDs
+func (fileCatalog *FileCatalog) SelectDatasets(ctx context.Context, ids []string) ([]*dataset.Dataset, error) {
+	return selectDatasets(fileCatalog.datasets, ids), nil
+}
+
+// GetDataset returns a dataset with the ID
+func (fileCatalog *FileCatalog) GetDataset(ctx context.Context, id string) (*dataset.Dataset, error) {
+	return findDataset(fileCatalog.datasets, id)
+}
@@ -0,0 +1,360 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+)
+
+const (
+	// DatasetPageSize is the number of datasets requested per page
+	DatasetPageSize = 100
+
+	// totalCountHeader is set by catalog services that support paging
+	totalCountHeader = "X-Total-Count"
+)
+
+// datasetStream decodes a JSON array of datasets one at a time
+type datasetStream struct {
+	url     string
+	body    io.ReadCloser
+	decoder *json.Decoder
+}
+
+func newDatasetStream(url string, body io.ReadCloser) (*datasetStream, error) {
+	// keep the beginning of the body to describe a malformed payload
+	head := &bytes.Buffer{}
+	decoder := json.NewDecoder(io.TeeReader(body, &limitedWriter{buffer: head, limit: bodyExcerptLen}))
+
+	token, err := decoder.Token()
+	if err != nil {
+		body.Close()
+		return nil, newMalformedPayloadError(url, head.Bytes(), err)
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		body.Close()
+		return nil, newMalformedPayloadError(url, head.Bytes(), fmt.Errorf("expected a list of datasets"))
+	}
+
+	return &datasetStream{
+		url:     url,
+		body:    body,
+		decoder: decoder,
+	}, nil
+}
+
+func (stream *datasetStream) next() (*dataset.Dataset, error) {
+	if !stream.decoder.More() {
+		return nil, io.EOF
+	}
+
+	ds := dataset.Dataset{}
+	err := stream.decoder.Decode(&ds)
+	if err != nil {
+		return nil, newMalformedPayloadError(stream.url, nil, err)
+	}
+	return &ds, nil
+}
+
+func (stream *datasetStream) close() error {
+	return stream.body.Close()
+}
+
+// limitedWriter keeps up to limit bytes written and discards the rest
+type limitedWriter struct {
+	buffer *bytes.Buffer
+	limit  int
+}
+
+func (writer *limitedWriter) Write(p []byte) (int, error) {
+	remaining := writer.limit - writer.buffer.Len()
+	if remaining > 0 {
+		if len(p) < remaining {
+			remaining = len(p)
+		}
+		writer.buffer.Write(p[:remaining])
+	}
+	return len(p), nil
+}
+
+// DatasetIterator iterates over datasets in a catalog
+type DatasetIterator interface {
+	// Next returns the next dataset, or io.EOF when there are no more datasets
+	Next() (*dataset.Dataset, error)
+	// Close releases resources held by the iterator
+	Close() error
+}
+
+// sliceDatasetIterator iterates over datasets in memory
+type sliceDatasetIterator struct {
+	datasets []*dataset.Dataset
+}
+
+func newSliceDatasetIterator(datasets []*dataset.Dataset, offset int, limit int) *sliceDatasetIterator {
+	if offset < 0 {
+		offset = 0
+	}
+
+	if offset > len(datasets) {
+		offset = len(datasets)
+	}
+
+	datasets = datasets[offset:]
+	if limit > 0 && limit < len(datasets) {
+		datasets = datasets[:limit]
+	}
+
+	return &sliceDatasetIterator{
+		datasets: datasets,
+	}
+}
+
+func (iter *sliceDatasetIterator) Next() (*dataset.Dataset, error) {
+	if len(iter.datasets) == 0 {
+		return nil, io.EOF
+	}
+
+	ds := iter.datasets[0]
+	iter.datasets = iter.datasets[1:]
+	return ds, nil
+}
+
+func (iter *sliceDatasetIterator) Close() error {
+	iter.datasets = nil
+	return nil
+}
+
+// pagedDatasetIterator iterates over datasets of catalog service page by page
+// If the catalog service does not support paging, it streams the whole list instead
+type pagedDatasetIterator struct {
+	ctx      context.Context
+	client   *ParcelCatalogServiceClient
+	offset   int
+	limit    int
+	pageSize int
+
+	buffer   []*dataset.Dataset
+	stream   *datasetStream
+	skip     int
+	started  bool
+	lastPage bool
+}
+
+// IterateDatasets returns an iterator over datasets starting from offset
+// A limit of 0 or less means no limit
+// The context is used by all requests made while iterating
+func (client *ParcelCatalogServiceClient) IterateDatasets(ctx context.Context, offset int, limit int) DatasetIterator {
+	if offset < 0 {
+		offset = 0
+	}
+
+	if limit <= 0 {
+		limit = -1
+	}
+
+	return &pagedDatasetIterator{
+		ctx:      ctx,
+		client:   client,
+		offset:   offset,
+		limit:    limit,
+		pageSize: DatasetPageSize,
+	}
+}
+
+// ListDatasets returns datasets in the given range
+// A limit of 0 or less means no limit
+func (client *ParcelCatalogServiceClient) ListDatasets(ctx context.Context, offset int, limit int) ([]*dataset.Dataset, error) {
+	iter := client.IterateDatasets(ctx, offset, limit)
+	defer iter.Close()
+
+	datasets := []*dataset.Dataset{}
+	for {
+		ds, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		datasets = append(datasets, ds)
+	}
+	return datasets, nil
+}
+
+// Next returns the next dataset, or io.EOF when there are no more datasets
+func (iter *pagedDatasetIterator) Next() (*dataset.Dataset, error) {
+	if iter.limit == 0 {
+		return nil, io.EOF
+	}
+
+	for {
+		if len(iter.buffer) > 0 {
+			ds := iter.buffer[0]
+			iter.buffer = iter.buffer[1:]
+			return iter.yield(ds), nil
+		}
+
+		if iter.stream != nil {
+			ds, err := iter.stream.next()
+			if err != nil {
+				return nil, err
+			}
+
+			if iter.skip > 0 {
+				iter.skip--
+				continue
+			}
+			return iter.yield(ds), nil
+		}
+
+		if iter.lastPage {
+			return nil, io.EOF
+		}
+
+		err := iter.fetchPage()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Close releases a response being streamed
+func (iter *pagedDatasetIterator) Close() error {
+	iter.buffer = nil
+	iter.lastPage = true
+
+	if iter.stream != nil {
+		err := iter.stream.close()
+		iter.stream = nil
+		return err
+	}
+	return nil
+}
+
+func (iter *pagedDatasetIterator) yield(ds *dataset.Dataset) *dataset.Dataset {
+	if iter.limit > 0 {
+		iter.limit--
+	}
+	return ds
+}
+
+func (iter *pagedDatasetIterator) fetchPage() error {
+	firstPage := !iter.started
+	iter.started = true
+
+	if firstPage {
+		if datasets, ok := iter.client.cachedDatasets(false); ok {
+			iter.useCachedDatasets(datasets)
+			return nil
+		}
+
+		if iter.client.offline {
+			return fmt.Errorf("no cached catalog of %s is available offline", iter.client.catalogServiceURL)
+		}
+	}
+
+	pageSize := iter.pageSize
+	if iter.limit > 0 && iter.limit < pageSize {
+		pageSize = iter.limit
+	}
+
+	stream, paged, err := iter.client.openDatasetStream(iter.ctx, iter.offset, pageSize)
+	if err != nil {
+		if firstPage && iter.ctx.Err() == nil {
+			if datasets, ok := iter.client.cachedDatasets(true); ok {
+				log.Printf("Catalog service is unreachable, using cached catalog - %v", err)
+				iter.useCachedDatasets(datasets)
+				return nil
+			}
+		}
+		return err
+	}
+
+	if !paged {
+		// the service sends the whole list, skip datasets before the offset locally
+		iter.stream = stream
+		iter.skip = iter.offset
+		return nil
+	}
+	defer stream.close()
+
+	page := []*dataset.Dataset{}
+	for len(page) < pageSize {
+		ds, err := stream.next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		page = append(page, ds)
+	}
+
+	if len(page) < pageSize {
+		iter.lastPage = true
+	}
+
+	iter.offset += len(page)
+	iter.buffer = page
+	return nil
+}
+
+func (iter *pagedDatasetIterator) useCachedDatasets(datasets []*dataset.Dataset) {
+	if iter.offset < len(datasets) {
+		iter.buffer = datasets[iter.offset:]
+	}
+	iter.lastPage = true
+}
+
+// openDatasetStream requests a page of datasets and returns a stream over the response
+// paged is false if the service ignored the paging parameters
+func (client *ParcelCatalogServiceClient) openDatasetStream(ctx context.Context, offset int, limit int) (*datasetStream, bool, error) {
+	requestURL := client.makeListURL(ctx)
+
+	req := client.newRequest(withStreaming(ctx)).SetDoNotParseResponse(true).SetQueryParams(map[string]string{
+		"offset": fmt.Sprintf("%d", offset),
+		"limit":  fmt.Sprintf("%d", limit),
+	})
+
+	resp, err := req.Get(requestURL)
+	traceResponse(client.trace, resp, err)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = checkResponse(resp)
+	if err != nil {
+		return nil, false, err
+	}
+
+	paged := client.getAPI(ctx).Paging || len(resp.Header().Get(totalCountHeader)) > 0
+
+	stream, err := newDatasetStream(requestURL, resp.RawBody())
+	if err != nil {
+		return nil, false, err
+	}
+	return stream, paged, nil
+}
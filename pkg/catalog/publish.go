@@ -0,0 +1,142 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+)
+
+const (
+	// legacyDatasetPath is a path of a single dataset of catalog services that do not describe one
+	legacyDatasetPath = "/datasets/%s"
+)
+
+// Publisher creates, updates and deletes datasets of a catalog
+type Publisher interface {
+	// CreateDataset registers a new dataset and returns it as stored by the catalog
+	CreateDataset(ctx context.Context, ds *dataset.Dataset) (*dataset.Dataset, error)
+	// UpdateDataset replaces the dataset with the same ID and returns it as stored by the catalog
+	UpdateDataset(ctx context.Context, ds *dataset.Dataset) (*dataset.Dataset, error)
+	// DeleteDataset removes the dataset with the ID
+	DeleteDataset(ctx context.Context, id string) error
+}
+
+// CreateDataset registers a new dataset with a POST to the list endpoint
+func (client *ParcelCatalogServiceClient) CreateDataset(ctx context.Context, ds *dataset.Dataset) (*dataset.Dataset, error) {
+	if client.offline {
+		return nil, fmt.Errorf("datasets cannot be published offline")
+	}
+
+	requestURL := client.makeListURL(ctx)
+	resp, err := client.newRequest(ctx).SetBody(ds).Post(requestURL)
+	return client.decodePublishedDataset(requestURL, ds, resp, err)
+}
+
+// UpdateDataset replaces the dataset with a PUT to the single-dataset endpoint
+func (client *ParcelCatalogServiceClient) UpdateDataset(ctx context.Context, ds *dataset.Dataset) (*dataset.Dataset, error) {
+	if client.offline {
+		return nil, fmt.Errorf("datasets cannot be edited offline")
+	}
+
+	requestURL := client.makeDatasetURL(ctx, strconv.FormatInt(ds.ID, 10))
+	resp, err := client.newRequest(ctx).SetBody(ds).Put(requestURL)
+	return client.decodePublishedDataset(requestURL, ds, resp, err)
+}
+
+// DeleteDataset removes the dataset with a DELETE to the single-dataset endpoint
+func (client *ParcelCatalogServiceClient) DeleteDataset(ctx context.Context, id string) error {
+	if client.offline {
+		return fmt.Errorf("datasets cannot be retracted offline")
+	}
+
+	requestURL := client.makeDatasetURL(ctx, id)
+	resp, err := client.newRequest(ctx).Delete(requestURL)
+	traceResponse(client.trace, resp, err)
+	if err != nil {
+		return err
+	}
+
+	err = checkResponse(resp)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("%w - %s", ErrDatasetNotFound, id)
+		}
+		return err
+	}
+
+	client.invalidateCache()
+	return nil
+}
+
+// makeDatasetURL returns the URL of a single dataset
+func (client *ParcelCatalogServiceClient) makeDatasetURL(ctx context.Context, id string) string {
+	requestURL, ok := client.makeEndpointURL(ctx, EndpointGet, id)
+	if !ok {
+		return makeRequestPath(client.catalogServiceURL, fmt.Sprintf(legacyDatasetPath, url.PathEscape(id)))
+	}
+	return requestURL
+}
+
+// decodePublishedDataset checks the response of a POST or PUT and returns the stored dataset
+// Services that respond without a body are assumed to store the dataset as sent
+func (client *ParcelCatalogServiceClient) decodePublishedDataset(requestURL string, ds *dataset.Dataset, resp *resty.Response, err error) (*dataset.Dataset, error) {
+	traceResponse(client.trace, resp, err)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkResponse(resp)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) && ds.ID != 0 {
+			return nil, fmt.Errorf("%w - %d", ErrDatasetNotFound, ds.ID)
+		}
+		return nil, err
+	}
+
+	client.invalidateCache()
+
+	body := bytes.TrimSpace(resp.Body())
+	if len(body) == 0 {
+		return ds, nil
+	}
+
+	stored := dataset.Dataset{}
+	err = json.Unmarshal(body, &stored)
+	if err != nil {
+		return nil, newMalformedPayloadError(requestURL, body, err)
+	}
+	return &stored, nil
+}
+
+// invalidateCache removes the cached dataset list, so that the next read sees the change
+func (client *ParcelCatalogServiceClient) invalidateCache() {
+	if client.cache == nil {
+		return
+	}
+
+	err := client.cache.remove(client.catalogServiceURL)
+	if err != nil {
+		log.Printf("Could not invalidate cached catalog - %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"github.com/iychoi/parcel/pkg/query"
+)
+
+// Selection is a result of resolving dataset selectors
+type Selection struct {
+	// Datasets are selected datasets without duplicates, in the order of selectors
+	Datasets []*dataset.Dataset
+	// Unmatched are selectors that matched no datasets
+	Unmatched []string
+	// Ambiguous are selectors that must match one dataset but matched more
+	Ambiguous map[string][]*dataset.Dataset
+}
+
+// Err returns an error describing unmatched or ambiguous selectors, or nil if all selectors are resolved
+// Unmatched selectors give an error wrapping ErrDatasetNotFound
+func (selection *Selection) Err() error {
+	if len(selection.Ambiguous) > 0 {
+		selectors := []string{}
+		for selector := range selection.Ambiguous {
+			selectors = append(selectors, selector)
+		}
+		sort.Strings(selectors)
+		return fmt.Errorf("%s matched multiple datasets", strings.Join(selectors, ", "))
+	}
+
+	if len(selection.Unmatched) > 0 {
+		return fmt.Errorf("%w - %s", ErrDatasetNotFound, strings.Join(selection.Unmatched, ", "))
+	}
+	return nil
+}
+
+// SelectDatasetsBy resolves selectors into datasets of the catalog
+//
+// A selector is a dataset reference (an ID, or <catalog>/<id> for federated catalogs),
+// an exact dataset name, or a glob pattern of names, e.g. "human*".
+// References and names must match one dataset, patterns may match many.
+// Datasets matching the query are selected too, if the query is given.
+func SelectDatasetsBy(ctx context.Context, catalog Catalog, selectors []string, q *query.Query) (*Selection, error) {
+	selection := &Selection{
+		Datasets:  []*dataset.Dataset{},
+		Unmatched: []string{},
+		Ambiguous: map[string][]*dataset.Dataset{},
+	}
+
+	selected := map[string]bool{}
+	addDatasets := func(datasets []*dataset.Dataset) {
+		for _, ds := range datasets {
+			ref := GetDatasetRef(ds)
+			if !selected[ref] {
+				selected[ref] = true
+				selection.Datasets = append(selection.Datasets, ds)
+			}
+		}
+	}
+
+	if len(selectors) > 0 {
+		datasets, err := catalog.GetAllDatasets(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, selector := range selectors {
+			matches, err := matchSelector(datasets, selector)
+			if err != nil {
+				return nil, err
+			}
+
+			switch {
+			case len(matches) == 0:
+				selection.Unmatched = append(selection.Unmatched, selector)
+			case len(matches) > 1 && !isGlobPattern(selector):
+				selection.Ambiguous[selector] = matches
+			default:
+				addDatasets(matches)
+			}
+		}
+	}
+
+	if q != nil {
+		datasets, err := QueryDatasets(ctx, catalog, q, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(datasets) == 0 {
+			selection.Unmatched = append(selection.Unmatched, q.String())
+		}
+		addDatasets(datasets)
+	}
+	return selection, nil
+}
+
+func matchSelector(datasets []*dataset.Dataset, selector string) ([]*dataset.Dataset, error) {
+	if isDatasetRef(selector) {
+		return matchDatasetRef(datasets, selector), nil
+	}
+
+	matches := []*dataset.Dataset{}
+	if isGlobPattern(selector) {
+		pattern := strings.ToLower(selector)
+		for _, ds := range datasets {
+			matched, err := path.Match(pattern, strings.ToLower(ds.Name))
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern '%s' - %v", selector, err)
+			}
+
+			if matched {
+				matches = append(matches, ds)
+			}
+		}
+		return matches, nil
+	}
+
+	// exact names, case is ignored only if no name matches exactly
+	for _, ds := range datasets {
+		if ds.Name == selector {
+			matches = append(matches, ds)
+		}
+	}
+
+	if len(matches) == 0 {
+		for _, ds := range datasets {
+			if strings.EqualFold(ds.Name, selector) {
+				matches = append(matches, ds)
+			}
+		}
+	}
+	return matches, nil
+}
+
+// isDatasetRef checks if the selector is an ID or <catalog>/<id>
+func isDatasetRef(selector string) bool {
+	catalogName, id := ParseDatasetRef(selector)
+	if len(catalogName) > 0 && !catalogNameRegexp.MatchString(catalogName) {
+		return false
+	}
+
+	_, err := strconv.ParseInt(id, 10, 64)
+	return err == nil
+}
+
+func isGlobPattern(selector string) bool {
+	return strings.ContainsAny(selector, "*?[")
+}
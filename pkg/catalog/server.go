@@ -0,0 +1,247 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package catalog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ServerServiceVersion is the service version reported by the discovery document of CatalogServer
+	ServerServiceVersion = "parcel-mock"
+
+	serverListPath   = "/datasets"
+	serverSearchPath = "/datasets/search"
+	serverGetPath    = "/datasets/{id}"
+
+	serverShutdownTimeout = 5 * time.Second
+)
+
+// CatalogServer serves datasets of a catalog over the catalog service API
+// It serves the discovery document at the root, the paged dataset list, search, and single-dataset endpoints.
+type CatalogServer struct {
+	catalog Catalog
+	trace   bool
+	mux     *http.ServeMux
+}
+
+// NewCatalogServer returns a server serving datasets of the catalog
+func NewCatalogServer(catalog Catalog, trace bool) *CatalogServer {
+	server := &CatalogServer{
+		catalog: catalog,
+		trace:   trace,
+		mux:     http.NewServeMux(),
+	}
+
+	server.mux.HandleFunc("/", server.handleDiscovery)
+	server.mux.HandleFunc(serverListPath, server.handleList)
+	server.mux.HandleFunc(serverListPath+"/", server.handleDataset)
+	return server
+}
+
+// ListenAndServe serves requests at the address until the context is cancelled
+func (server *CatalogServer) ListenAndServe(ctx context.Context, address string) error {
+	httpServer := &http.Server{
+		Addr:    address,
+		Handler: server,
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		return httpServer.Shutdown(shutdownCtx)
+	}
+}
+
+// ServeHTTP serves a request
+func (server *CatalogServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if server.trace {
+		log.Printf("%s %s", r.Method, r.URL.RequestURI())
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	server.mux.ServeHTTP(w, r)
+}
+
+func (server *CatalogServer) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	doc := DiscoveryDocument{
+		ServiceVersion: ServerServiceVersion,
+		APIs: []APIDescription{
+			{
+				Version: APIVersionV1,
+				Endpoints: map[string]string{
+					EndpointList:   serverListPath,
+					EndpointSearch: serverSearchPath,
+					EndpointGet:    serverGetPath,
+				},
+				Paging: true,
+			},
+		},
+	}
+	writeJSON(w, r, doc)
+}
+
+func (server *CatalogServer) handleList(w http.ResponseWriter, r *http.Request) {
+	datasets, err := server.catalog.GetAllDatasets(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	total := len(datasets)
+	offset, err := getIntParam(r, "offset")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	limit, err := getIntParam(r, "limit")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if offset > len(datasets) {
+		offset = len(datasets)
+	}
+	datasets = datasets[offset:]
+
+	if limit > 0 && limit < len(datasets) {
+		datasets = datasets[:limit]
+	}
+
+	w.Header().Set(totalCountHeader, strconv.Itoa(total))
+	writeJSON(w, r, datasets)
+}
+
+func (server *CatalogServer) handleDataset(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, serverListPath+"/")
+	if id == strings.TrimPrefix(serverSearchPath, serverListPath+"/") {
+		server.handleSearch(w, r)
+		return
+	}
+
+	if len(id) == 0 || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	ds, err := server.catalog.GetDataset(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, r, ds)
+}
+
+func (server *CatalogServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	page, err := getIntParam(r, "page")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	limit, err := getIntParam(r, "limit")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	datasets, err := server.catalog.SearchDatasets(r.Context(), params["keywords"], &SearchOptions{
+		Page:  page,
+		Limit: limit,
+		Sort:  params.Get("sort"),
+	})
+	if err != nil {
+		writeError(w, fmt.Errorf("%w - %v", ErrBadRequest, err))
+		return
+	}
+	writeJSON(w, r, datasets)
+}
+
+// getIntParam returns a non-negative integer query parameter, 0 if it is absent
+func getIntParam(r *http.Request, name string) (int, error) {
+	param := r.URL.Query().Get(name)
+	if len(param) == 0 {
+		return 0, nil
+	}
+
+	value, err := strconv.Atoi(param)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%w - invalid %s '%s'", ErrBadRequest, name, param)
+	}
+	return value, nil
+}
+
+// writeJSON writes a JSON response with an ETag, answering conditional requests with 304
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	etag := fmt.Sprintf("\"%x\"", sha256.Sum256(jsonBytes))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(jsonBytes)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(jsonBytes)
+	}
+}
+
+// writeError writes an error response with a status of the error kind
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrBadRequest):
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,334 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package citation
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"github.com/iychoi/parcel/pkg/catalog"
+)
+
+const (
+	// DOITag is a dataset tag holding a DOI, e.g. 10.1234/abcd or https://doi.org/10.1234/abcd
+	DOITag = "doi"
+	// AuthorsTag is a dataset tag holding authors separated by ';', e.g. "Doe, Jane; Roe, Richard"
+	AuthorsTag = "authors"
+	// PublicationYearTag is a dataset tag holding the year of publication
+	PublicationYearTag = "publication year"
+	// YearTag is a dataset tag holding the year of publication, read if PublicationYearTag is absent
+	YearTag = "year"
+	// CitationTag is a dataset tag holding a citation text given by the publisher
+	CitationTag = "citation"
+
+	// FormatBibTeX is a BibTeX format
+	FormatBibTeX = "bibtex"
+	// FormatRIS is a RIS format
+	FormatRIS = "ris"
+	// FormatCSLJSON is a CSL-JSON format
+	FormatCSLJSON = "csl-json"
+)
+
+var (
+	doiPrefixRegexp = regexp.MustCompile(`(?i)^(https?://(dx\.)?doi\.org/|doi:)`)
+	keyRegexp       = regexp.MustCompile(`[^A-Za-z0-9]+`)
+)
+
+// Citation is a citation of a dataset
+type Citation struct {
+	Key       string
+	Title     string
+	Authors   []string
+	Year      int
+	DOI       string
+	URL       string
+	Abstract  string
+	Publisher string
+	Accessed  time.Time
+	// Note is a citation text given by the publisher
+	Note string
+}
+
+// NewCitation returns a citation of a dataset accessed at the given time
+// Authors, DOI, year and the publisher's citation text are read from dataset tags, the creator is the author if the tag is absent.
+func NewCitation(ds *dataset.Dataset, accessed time.Time) (*Citation, error) {
+	citation := &Citation{
+		Key:       "parcel-" + strings.Trim(keyRegexp.ReplaceAllString(catalog.GetDatasetRef(ds), "-"), "-"),
+		Title:     strings.TrimSpace(ds.Name),
+		URL:       strings.TrimSpace(ds.URL),
+		Abstract:  strings.TrimSpace(ds.Description),
+		Publisher: strings.TrimSpace(ds.Host),
+		Accessed:  accessed,
+	}
+
+	if note, ok := ds.Tags[CitationTag]; ok {
+		citation.Note = strings.TrimSpace(note)
+	}
+
+	if authors, ok := ds.Tags[AuthorsTag]; ok {
+		for _, author := range strings.Split(authors, ";") {
+			author = strings.TrimSpace(author)
+			if len(author) > 0 {
+				citation.Authors = append(citation.Authors, author)
+			}
+		}
+	}
+
+	if len(citation.Authors) == 0 && len(strings.TrimSpace(ds.Creator)) > 0 {
+		citation.Authors = []string{strings.TrimSpace(ds.Creator)}
+	}
+
+	if doi, ok := ds.Tags[DOITag]; ok {
+		citation.DOI = doiPrefixRegexp.ReplaceAllString(strings.TrimSpace(doi), "")
+	}
+
+	for _, yearTag := range []string{PublicationYearTag, YearTag} {
+		year, ok := ds.Tags[yearTag]
+		if !ok || len(strings.TrimSpace(year)) == 0 {
+			continue
+		}
+
+		y, err := strconv.Atoi(strings.TrimSpace(year))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s tag of dataset %s - %v", yearTag, catalog.GetDatasetRef(ds), err)
+		}
+		citation.Year = y
+		break
+	}
+
+	return citation, nil
+}
+
+// ValidateFormat checks that the citation format is known
+func ValidateFormat(format string) error {
+	switch strings.ToLower(format) {
+	case FormatBibTeX, FormatRIS, FormatCSLJSON:
+		return nil
+	default:
+		return fmt.Errorf("unknown citation format - %s", format)
+	}
+}
+
+// Format returns citations in the format
+func Format(citations []*Citation, format string) (string, error) {
+	err := ValidateFormat(format)
+	if err != nil {
+		return "", err
+	}
+
+	switch strings.ToLower(format) {
+	case FormatBibTeX:
+		return FormatAsBibTeX(citations), nil
+	case FormatRIS:
+		return FormatAsRIS(citations), nil
+	default:
+		return FormatAsCSLJSON(citations)
+	}
+}
+
+// FormatAsBibTeX returns citations as BibTeX @misc entries
+func FormatAsBibTeX(citations []*Citation) string {
+	sb := strings.Builder{}
+	for idx, citation := range citations {
+		if idx > 0 {
+			sb.WriteString("\n")
+		}
+
+		fields := [][]string{
+			{"title", citation.Title},
+			{"author", strings.Join(citation.Authors, " and ")},
+		}
+
+		if citation.Year > 0 {
+			fields = append(fields, []string{"year", strconv.Itoa(citation.Year)})
+		}
+
+		fields = append(fields,
+			[]string{"publisher", citation.Publisher},
+			[]string{"doi", citation.DOI},
+			[]string{"url", citation.URL},
+			[]string{"urldate", formatDate(citation.Accessed)},
+			[]string{"abstract", citation.Abstract},
+			[]string{"note", citation.Note},
+		)
+
+		fmt.Fprintf(&sb, "@misc{%s,\n", citation.Key)
+		for _, field := range fields {
+			if len(field[1]) == 0 {
+				continue
+			}
+
+			value := field[1]
+			if field[0] != "url" && field[0] != "doi" {
+				// url and doi are verbatim in biblatex and natbib styles
+				value = escapeBibTeX(value)
+			}
+			fmt.Fprintf(&sb, "  %s = {%s},\n", field[0], value)
+		}
+		sb.WriteString("}\n")
+	}
+	return sb.String()
+}
+
+// escapeBibTeX escapes characters special to LaTeX
+func escapeBibTeX(text string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\textbackslash{}`,
+		`{`, `\{`,
+		`}`, `\}`,
+		`&`, `\&`,
+		`%`, `\%`,
+		`$`, `\$`,
+		`#`, `\#`,
+		`_`, `\_`,
+		`~`, `\textasciitilde{}`,
+		`^`, `\textasciicircum{}`,
+	)
+	return replacer.Replace(collapseSpaces(text))
+}
+
+// FormatAsRIS returns citations as RIS records of type DATA
+func FormatAsRIS(citations []*Citation) string {
+	sb := strings.Builder{}
+	writeTag := func(tag string, value string) {
+		if len(value) > 0 {
+			fmt.Fprintf(&sb, "%s  - %s\n", tag, collapseSpaces(value))
+		}
+	}
+
+	for _, citation := range citations {
+		writeTag("TY", "DATA")
+		writeTag("ID", citation.Key)
+		writeTag("TI", citation.Title)
+		for _, author := range citation.Authors {
+			writeTag("AU", author)
+		}
+
+		if citation.Year > 0 {
+			writeTag("PY", strconv.Itoa(citation.Year))
+		}
+
+		writeTag("PB", citation.Publisher)
+		writeTag("DO", citation.DOI)
+		writeTag("UR", citation.URL)
+		writeTag("Y2", formatDate(citation.Accessed))
+		writeTag("AB", citation.Abstract)
+		writeTag("N1", citation.Note)
+		sb.WriteString("ER  - \n")
+	}
+	return sb.String()
+}
+
+// cslName is a name of a CSL-JSON author
+type cslName struct {
+	Family  string `json:"family,omitempty"`
+	Given   string `json:"given,omitempty"`
+	Literal string `json:"literal,omitempty"`
+}
+
+// cslDate is a date of a CSL-JSON item
+type cslDate struct {
+	DateParts [][]int `json:"date-parts"`
+}
+
+// cslItem is a CSL-JSON item
+type cslItem struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Title     string    `json:"title"`
+	Author    []cslName `json:"author,omitempty"`
+	Issued    *cslDate  `json:"issued,omitempty"`
+	Accessed  *cslDate  `json:"accessed,omitempty"`
+	Publisher string    `json:"publisher,omitempty"`
+	DOI       string    `json:"DOI,omitempty"`
+	URL       string    `json:"URL,omitempty"`
+	Abstract  string    `json:"abstract,omitempty"`
+	Note      string    `json:"note,omitempty"`
+}
+
+// FormatAsCSLJSON returns citations as a CSL-JSON array of dataset items
+func FormatAsCSLJSON(citations []*Citation) (string, error) {
+	items := []cslItem{}
+	for _, citation := range citations {
+		item := cslItem{
+			ID:        citation.Key,
+			Type:      "dataset",
+			Title:     citation.Title,
+			Publisher: citation.Publisher,
+			DOI:       citation.DOI,
+			URL:       citation.URL,
+			Abstract:  citation.Abstract,
+			Note:      citation.Note,
+		}
+
+		for _, author := range citation.Authors {
+			item.Author = append(item.Author, makeCSLName(author))
+		}
+
+		if citation.Year > 0 {
+			item.Issued = &cslDate{
+				DateParts: [][]int{{citation.Year}},
+			}
+		}
+
+		if !citation.Accessed.IsZero() {
+			item.Accessed = &cslDate{
+				DateParts: [][]int{{citation.Accessed.Year(), int(citation.Accessed.Month()), citation.Accessed.Day()}},
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	sb := strings.Builder{}
+	encoder := json.NewEncoder(&sb)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(items)
+	if err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// makeCSLName splits "Family, Given" names, other names such as organizations are kept literal
+func makeCSLName(author string) cslName {
+	parts := strings.SplitN(author, ",", 2)
+	if len(parts) == 2 && len(strings.TrimSpace(parts[0])) > 0 && len(strings.TrimSpace(parts[1])) > 0 {
+		return cslName{
+			Family: strings.TrimSpace(parts[0]),
+			Given:  strings.TrimSpace(parts[1]),
+		}
+	}
+	return cslName{
+		Literal: author,
+	}
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+// collapseSpaces replaces line breaks and runs of spaces with a space
+func collapseSpaces(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -26,11 +26,23 @@ const (
 	ParcelConfigPath = "/etc/parcel.config"
 )
 
+// CatalogEndpoint is a named catalog service searched together with others
+type CatalogEndpoint struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
 // Config object contains configuration
 type Config struct {
-	CatalogServiceURL    string `json:"catalogServiceURL"`
-	Namespace            string `json:"namespace"`
-	KubernetesConfigPath string `json:"kubernetesConfigPath"`
+	CatalogServiceURL    string            `json:"catalogServiceURL"`
+	Catalogs             []CatalogEndpoint `json:"catalogs,omitempty"`
+	Namespace            string            `json:"namespace"`
+	KubernetesConfigPath string            `json:"kubernetesConfigPath"`
+	CacheTTL             string            `json:"cacheTTL"`
+	Timeout              string            `json:"timeout"`
+	Retries              *int              `json:"retries,omitempty"`
+	AuthIssuer           string            `json:"authIssuer,omitempty"`
+	AuthClientID         string            `json:"authClientID,omitempty"`
 }
 
 // GetConfig returns Config object
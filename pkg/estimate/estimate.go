@@ -0,0 +1,266 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package estimate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"github.com/iychoi/parcel/pkg/webdav"
+	resourcev1 "k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// SizeTag is a dataset tag holding the total size, in bytes or as a quantity, e.g. 5Gi
+	SizeTag = "size"
+	// FileCountTag is a dataset tag holding the number of files
+	FileCountTag = "files"
+
+	// SourceMetadata means an estimate is read from dataset tags
+	SourceMetadata = "metadata"
+	// SourceCrawl means an estimate is made by crawling the dataset
+	SourceCrawl = "crawl"
+
+	// EstimateTTL is a default time crawled estimates are kept in cache
+	EstimateTTL = 24 * time.Hour
+
+	estimateCacheFileName = "estimates.json"
+)
+
+var (
+	// ErrNoEstimate is returned when the size of a dataset cannot be estimated
+	ErrNoEstimate = errors.New("size cannot be estimated")
+)
+
+// Estimate is a total size and a file count of a dataset
+// Files is -1 if unknown
+type Estimate struct {
+	Bytes       int64     `json:"bytes"`
+	Files       int64     `json:"files"`
+	Source      string    `json:"source"`
+	EstimatedAt time.Time `json:"estimatedAt"`
+}
+
+// Estimator estimates sizes of datasets from metadata, cached estimates, or by crawling
+type Estimator struct {
+	cacheDir       string
+	ttl            time.Duration
+	webdavOptions  *webdav.ClientOptions
+	estimates      map[string]*Estimate
+	estimatesMutex sync.Mutex
+	loadOnce       sync.Once
+}
+
+// NewEstimator returns an estimator keeping crawled estimates in the cache dir for ttl
+// An empty cache dir disables caching
+func NewEstimator(cacheDir string, ttl time.Duration, webdavOptions *webdav.ClientOptions) *Estimator {
+	return &Estimator{
+		cacheDir:      cacheDir,
+		ttl:           ttl,
+		webdavOptions: webdavOptions,
+		estimates:     map[string]*Estimate{},
+	}
+}
+
+// Estimate returns an estimate from metadata or cache, and crawls the dataset if crawl is true
+// It returns ErrNoEstimate if the size is unknown
+func (estimator *Estimator) Estimate(ctx context.Context, ds *dataset.Dataset, crawl bool) (*Estimate, error) {
+	est, err := getMetadataEstimate(ds)
+	if err != nil {
+		return nil, err
+	}
+
+	if est != nil {
+		return est, nil
+	}
+
+	est = estimator.getCachedEstimate(ds)
+	if est != nil {
+		return est, nil
+	}
+
+	if !crawl {
+		return nil, ErrNoEstimate
+	}
+
+	est, err = estimator.crawl(ctx, ds)
+	if err != nil {
+		return nil, err
+	}
+
+	estimator.setCachedEstimate(ds, est)
+	return est, nil
+}
+
+// getMetadataEstimate returns an estimate from dataset tags, or nil if tags do not have the size
+func getMetadataEstimate(ds *dataset.Dataset) (*Estimate, error) {
+	sizeTag, ok := ds.Tags[SizeTag]
+	if !ok || len(strings.TrimSpace(sizeTag)) == 0 {
+		return nil, nil
+	}
+
+	size, err := ParseSize(sizeTag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid size tag of dataset %d - %v", ds.ID, err)
+	}
+
+	files := int64(-1)
+	if fileCountTag, ok := ds.Tags[FileCountTag]; ok {
+		files, err = strconv.ParseInt(strings.TrimSpace(fileCountTag), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file count tag of dataset %d - %v", ds.ID, err)
+		}
+	}
+
+	return &Estimate{
+		Bytes:  size,
+		Files:  files,
+		Source: SourceMetadata,
+	}, nil
+}
+
+// ParseSize parses a size in bytes, or a quantity, e.g. 5Gi or 100M
+func ParseSize(size string) (int64, error) {
+	size = strings.TrimSpace(size)
+	bytes, err := strconv.ParseInt(size, 10, 64)
+	if err == nil {
+		return bytes, nil
+	}
+
+	quantity, err := resourcev1.ParseQuantity(size)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse size '%s'", size)
+	}
+	return quantity.Value(), nil
+}
+
+// crawl sums sizes of files of a WebDAV dataset
+func (estimator *Estimator) crawl(ctx context.Context, ds *dataset.Dataset) (*Estimate, error) {
+	u, err := url.Parse(ds.URL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse URL: %v", err)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "webdav", "davfs":
+	default:
+		return nil, fmt.Errorf("%w - datasets served over %s cannot be crawled", ErrNoEstimate, u.Scheme)
+	}
+
+	client, err := webdav.NewClient(ds.URL, estimator.webdavOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := client.Collect(ctx, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	totalBytes := int64(0)
+	for _, file := range files {
+		if file.Size > 0 {
+			totalBytes += file.Size
+		}
+	}
+
+	return &Estimate{
+		Bytes:       totalBytes,
+		Files:       int64(len(files)),
+		Source:      SourceCrawl,
+		EstimatedAt: time.Now(),
+	}, nil
+}
+
+func (estimator *Estimator) getCachePath() string {
+	return filepath.Join(estimator.cacheDir, estimateCacheFileName)
+}
+
+func (estimator *Estimator) load() {
+	if len(estimator.cacheDir) == 0 {
+		return
+	}
+
+	jsonBytes, err := ioutil.ReadFile(estimator.getCachePath())
+	if err != nil {
+		return
+	}
+
+	// a broken cache is ignored and overwritten
+	err = json.Unmarshal(jsonBytes, &estimator.estimates)
+	if err != nil || estimator.estimates == nil {
+		estimator.estimates = map[string]*Estimate{}
+	}
+}
+
+func (estimator *Estimator) getCachedEstimate(ds *dataset.Dataset) *Estimate {
+	estimator.loadOnce.Do(estimator.load)
+
+	estimator.estimatesMutex.Lock()
+	defer estimator.estimatesMutex.Unlock()
+
+	est, ok := estimator.estimates[ds.URL]
+	if !ok || est == nil {
+		return nil
+	}
+
+	if estimator.ttl > 0 && time.Since(est.EstimatedAt) > estimator.ttl {
+		return nil
+	}
+	return est
+}
+
+func (estimator *Estimator) setCachedEstimate(ds *dataset.Dataset, est *Estimate) {
+	estimator.loadOnce.Do(estimator.load)
+
+	estimator.estimatesMutex.Lock()
+	defer estimator.estimatesMutex.Unlock()
+
+	estimator.estimates[ds.URL] = est
+
+	if len(estimator.cacheDir) > 0 {
+		// caching is best effort
+		estimator.save()
+	}
+}
+
+func (estimator *Estimator) save() error {
+	err := os.MkdirAll(estimator.cacheDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	jsonBytes, err := json.Marshal(estimator.estimates)
+	if err != nil {
+		return err
+	}
+
+	tempPath := fmt.Sprintf("%s.tmp", estimator.getCachePath())
+	err = ioutil.WriteFile(tempPath, jsonBytes, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempPath, estimator.getCachePath())
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"github.com/iychoi/parcel/pkg/catalog"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Labels select volumes, their values are sanitized to be valid label values.
+// Annotations keep the full metadata of the dataset.
+// Volumes created by older versions have the raw dataset name in the "dataset-name" label and no annotations.
+const (
+	volumeNameLabel     = "volume-name"
+	datasetIDLabel      = "dataset-id"
+	datasetNameLabel    = "dataset-name"
+	datasetCatalogLabel = "dataset-catalog"
+
+	annotationPrefix         = "parcel.iychoi/"
+	datasetNameAnnotation    = annotationPrefix + "dataset-name"
+	datasetURLAnnotation     = annotationPrefix + "dataset-url"
+	catalogURLAnnotation     = annotationPrefix + "catalog-url"
+	labelValueHashLen        = 8
+	labelValueSanitizedLimit = validation.LabelValueMaxLength - labelValueHashLen - 1
+)
+
+var (
+	invalidLabelCharsRegexp = regexp.MustCompile(`[^-_.A-Za-z0-9]+`)
+)
+
+func makeLabels(ds *dataset.Dataset, volumeName string) map[string]string {
+	labels := map[string]string{
+		volumeNameLabel:  makeLabelValue(volumeName),
+		datasetIDLabel:   strconv.FormatInt(ds.ID, 10),
+		datasetNameLabel: makeLabelValue(ds.Name),
+	}
+
+	// datasets of federated catalogs are referred with their catalog names
+	if catalogName, ok := ds.Tags[catalog.SourceCatalogTag]; ok && len(catalogName) > 0 {
+		labels[datasetCatalogLabel] = makeLabelValue(catalogName)
+	}
+	return labels
+}
+
+func makeAnnotations(ds *dataset.Dataset, catalogURL string) map[string]string {
+	annotations := map[string]string{
+		datasetNameAnnotation: ds.Name,
+		datasetURLAnnotation:  ds.URL,
+	}
+
+	if len(catalogURL) > 0 {
+		annotations[catalogURLAnnotation] = catalogURL
+	}
+	return annotations
+}
+
+// makeLabelValue returns a valid label value for the value
+// Values that are not valid are sanitized, truncated and suffixed with a hash of the value,
+// so that different values give different label values.
+func makeLabelValue(value string) string {
+	if len(validation.IsValidLabelValue(value)) == 0 {
+		return value
+	}
+
+	sanitized := invalidLabelCharsRegexp.ReplaceAllString(value, "-")
+	if len(sanitized) > labelValueSanitizedLimit {
+		sanitized = sanitized[:labelValueSanitizedLimit]
+	}
+	sanitized = strings.Trim(sanitized, "-_.")
+
+	hash := sha256.Sum256([]byte(value))
+	hashString := hex.EncodeToString(hash[:])[:labelValueHashLen]
+	if len(sanitized) == 0 {
+		return hashString
+	}
+	return fmt.Sprintf("%s-%s", sanitized, hashString)
+}
+
+// readDataset returns a dataset recorded in metadata of the pv
+// Annotations are preferred, labels of volumes created by older versions are read otherwise.
+func readDataset(pv *apiv1.PersistentVolume) (*dataset.Dataset, error) {
+	datasetID, found := pv.Labels[datasetIDLabel]
+	if !found {
+		return nil, fmt.Errorf("Could not find '%s' field in a persistent volume", datasetIDLabel)
+	}
+
+	id, err := strconv.ParseInt(datasetID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := dataset.Dataset{
+		ID: id,
+	}
+
+	if datasetName, found := pv.Annotations[datasetNameAnnotation]; found {
+		ds.Name = datasetName
+	} else if datasetName, found := pv.Labels[datasetNameLabel]; found {
+		ds.Name = datasetName
+	} else {
+		return nil, fmt.Errorf("Could not find '%s' field in a persistent volume", datasetNameLabel)
+	}
+
+	// catalog names are valid label values, they are never altered
+	if catalogName, found := pv.Labels[datasetCatalogLabel]; found {
+		ds.Tags = map[string]string{catalog.SourceCatalogTag: catalogName}
+	}
+
+	if datasetURL, found := pv.Annotations[datasetURLAnnotation]; found {
+		ds.URL = datasetURL
+	} else if pv.Spec.CSI != nil {
+		ds.URL = pv.Spec.CSI.VolumeAttributes["url"]
+	}
+	return &ds, nil
+}
+
+// isPersistentVolumeClaimOf checks if the pvc is the claim of the pv
+func isPersistentVolumeClaimOf(pvc *apiv1.PersistentVolumeClaim, pv *apiv1.PersistentVolume) bool {
+	return pvc.GetName() == getPersistentVolumeClaimName(pv) && pvc.Labels[volumeNameLabel] == makeLabelValue(pv.GetName())
+}
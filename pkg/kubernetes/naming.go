@@ -0,0 +1,143 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"github.com/lithammer/shortuuid/v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// DefaultVolumeNamePrefix is a default prefix of volume names
+	DefaultVolumeNamePrefix = "parcel"
+	// MaxVolumeNamePrefixLen is the max length of a prefix of volume names
+	MaxVolumeNamePrefixLen = 16
+
+	volumeNameInfix  = "-pv-"
+	claimNameSuffix  = "-claim"
+	handleNameSuffix = "-handle"
+
+	// claims and handles are named after volumes, all stay within a DNS label
+	maxVolumeNameLen = validation.DNS1123LabelMaxLength - len(handleNameSuffix)
+	// a random suffix of 12 lowercase characters has about 60 bits of entropy
+	randomSuffixLen = 12
+	hashSuffixLen   = 12
+)
+
+var (
+	nonAlphanumericRegexp = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// VolumeNames holds names of a volume, its claim and its CSI volume handle
+// Volume and claim names are valid DNS labels (RFC 1123).
+type VolumeNames struct {
+	Volume string
+	Claim  string
+	Handle string
+}
+
+// ValidateVolumeNamePrefix checks that the prefix can start volume names
+func ValidateVolumeNamePrefix(prefix string) error {
+	if len(prefix) > MaxVolumeNamePrefixLen {
+		return fmt.Errorf("volume name prefix %s is longer than %d characters", prefix, MaxVolumeNamePrefixLen)
+	}
+
+	errs := validation.IsDNS1123Label(prefix)
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid volume name prefix %s - %s", prefix, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// makeVolumeNames returns new names for a volume of the dataset, e.g. parcel-pv-human-genome-5k2x8mdqrf7a
+// The dataset name is kept as far as the length allows, and a random suffix keeps names unique.
+func makeVolumeNames(ds *dataset.Dataset, prefix string) (VolumeNames, error) {
+	if len(prefix) == 0 {
+		prefix = DefaultVolumeNamePrefix
+	}
+
+	err := ValidateVolumeNamePrefix(prefix)
+	if err != nil {
+		return VolumeNames{}, err
+	}
+
+	suffix := makeRandomSuffix()
+	return makeVolumeNamesWithSuffix(prefix, ds.Name, suffix), nil
+}
+
+// makeNamedVolumeNames returns names for a volume of a claim with the given name
+// The volume name is derived from the namespace and the claim name, as volumes are cluster-wide.
+func makeNamedVolumeNames(prefix string, namespace string, claimName string) (VolumeNames, error) {
+	if len(prefix) == 0 {
+		prefix = DefaultVolumeNamePrefix
+	}
+
+	err := ValidateVolumeNamePrefix(prefix)
+	if err != nil {
+		return VolumeNames{}, err
+	}
+
+	errs := validation.IsDNS1123Label(claimName)
+	if len(errs) > 0 {
+		return VolumeNames{}, fmt.Errorf("invalid claim name %s - %s", claimName, strings.Join(errs, ", "))
+	}
+
+	hash := sha256.Sum256([]byte(namespace + "/" + claimName))
+	names := makeVolumeNamesWithSuffix(prefix, claimName, hex.EncodeToString(hash[:])[:hashSuffixLen])
+	names.Claim = claimName
+	return names, nil
+}
+
+// makeVolumeNamesWithSuffix returns names made of the prefix, a slug of the name and the suffix
+func makeVolumeNamesWithSuffix(prefix string, name string, suffix string) VolumeNames {
+	base := prefix + volumeNameInfix
+	slug := makeNameSlug(name, maxVolumeNameLen-len(base)-len(suffix)-1)
+
+	volumeName := base + suffix
+	if len(slug) > 0 {
+		volumeName = fmt.Sprintf("%s%s-%s", base, slug, suffix)
+	}
+
+	return VolumeNames{
+		Volume: volumeName,
+		Claim:  volumeName + claimNameSuffix,
+		Handle: volumeName + handleNameSuffix,
+	}
+}
+
+// makeNameSlug returns a lowercase alphanumeric form of the name joined by '-', up to maxLen characters
+func makeNameSlug(name string, maxLen int) string {
+	slug := nonAlphanumericRegexp.ReplaceAllString(strings.ToLower(name), "-")
+	slug = strings.Trim(slug, "-")
+	if maxLen <= 0 {
+		return ""
+	}
+
+	if len(slug) > maxLen {
+		slug = strings.TrimRight(slug[:maxLen], "-")
+	}
+	return slug
+}
+
+func makeRandomSuffix() string {
+	// shortuuid uses mixed case, names must be lowercase
+	return strings.ToLower(shortuuid.New())[:randomSuffixLen]
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var testDatasetNames = []string{
+	"",
+	"Human Genome",
+	"human_genome_v2.1",
+	"  leading and trailing  ",
+	"!!!---???",
+	"...",
+	"-",
+	"日本語のデータセット",
+	"Ünïcödé Dätä 🧬",
+	"MiXeD CaSe 123",
+	strings.Repeat("a", 300),
+	strings.Repeat("ab-", 100),
+	strings.Repeat("日", 100),
+	strings.Repeat("a", 40) + "!" + strings.Repeat("b", 40),
+}
+
+var testPrefixes = []string{
+	"",
+	DefaultVolumeNamePrefix,
+	"a",
+	"x-1",
+	strings.Repeat("p", MaxVolumeNamePrefixLen),
+}
+
+// checkVolumeNames checks that names are DNS labels starting with the prefix
+func checkVolumeNames(names VolumeNames, prefix string) error {
+	if len(prefix) == 0 {
+		prefix = DefaultVolumeNamePrefix
+	}
+
+	for _, name := range []string{names.Volume, names.Claim, names.Handle} {
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return fmt.Errorf("%s is not a DNS label - %s", name, strings.Join(errs, ", "))
+		}
+
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return fmt.Errorf("%s is not a DNS subdomain - %s", name, strings.Join(errs, ", "))
+		}
+
+		if len(name) > validation.DNS1123LabelMaxLength {
+			return fmt.Errorf("%s is longer than %d characters", name, validation.DNS1123LabelMaxLength)
+		}
+	}
+
+	if len(names.Volume+claimNameSuffix) > validation.DNS1123LabelMaxLength {
+		return fmt.Errorf("%s%s is longer than %d characters", names.Volume, claimNameSuffix, validation.DNS1123LabelMaxLength)
+	}
+
+	if !strings.HasPrefix(names.Volume, prefix+volumeNameInfix) {
+		return fmt.Errorf("%s does not start with %s%s", names.Volume, prefix, volumeNameInfix)
+	}
+	return nil
+}
+
+func TestMakeVolumeNames(t *testing.T) {
+	for _, prefix := range testPrefixes {
+		for _, name := range testDatasetNames {
+			names, err := makeVolumeNames(&dataset.Dataset{Name: name}, prefix)
+			if err != nil {
+				t.Errorf("could not make names of %q with prefix %q - %v", name, prefix, err)
+				continue
+			}
+
+			err = checkVolumeNames(names, prefix)
+			if err != nil {
+				t.Errorf("names of %q with prefix %q: %v", name, prefix, err)
+			}
+
+			if names.Claim != names.Volume+claimNameSuffix {
+				t.Errorf("claim %s is not named after volume %s", names.Claim, names.Volume)
+			}
+		}
+	}
+}
+
+func TestMakeVolumeNamesQuick(t *testing.T) {
+	check := func(name string) bool {
+		names, err := makeVolumeNames(&dataset.Dataset{Name: name}, "")
+		if err != nil {
+			t.Logf("could not make names of %q - %v", name, err)
+			return false
+		}
+
+		err = checkVolumeNames(names, "")
+		if err != nil {
+			t.Logf("names of %q: %v", name, err)
+			return false
+		}
+		return true
+	}
+
+	err := quick.Check(check, &quick.Config{MaxCount: 1000})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMakeVolumeNamesUnique(t *testing.T) {
+	volumes := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		names, err := makeVolumeNames(&dataset.Dataset{Name: "same name"}, "")
+		if err != nil {
+			t.Fatalf("could not make names - %v", err)
+		}
+
+		if volumes[names.Volume] {
+			t.Fatalf("volume name %s is repeated", names.Volume)
+		}
+		volumes[names.Volume] = true
+	}
+}
+
+func TestMakeNamedVolumeNames(t *testing.T) {
+	namespaces := []string{"default", "parcel", "team-a"}
+	claimNames := []string{
+		"a",
+		"data",
+		"my-genome",
+		"team-a-data",
+		strings.Repeat("c", validation.DNS1123LabelMaxLength),
+		strings.Repeat("c", validation.DNS1123LabelMaxLength-1),
+	}
+
+	handles := map[string]string{}
+	volumes := map[string]string{}
+	for _, prefix := range testPrefixes {
+		for _, namespace := range namespaces {
+			for _, claimName := range claimNames {
+				pair := fmt.Sprintf("%s/%s", namespace, claimName)
+
+				names, err := makeNamedVolumeNames(prefix, namespace, claimName)
+				if err != nil {
+					t.Errorf("could not make names of %s with prefix %q - %v", pair, prefix, err)
+					continue
+				}
+
+				err = checkVolumeNames(names, prefix)
+				if err != nil {
+					t.Errorf("names of %s with prefix %q: %v", pair, prefix, err)
+				}
+
+				if names.Claim != claimName {
+					t.Errorf("expected claim %s, got %s", claimName, names.Claim)
+				}
+
+				if prefix != DefaultVolumeNamePrefix {
+					// an empty prefix is the default one, names are checked once
+					continue
+				}
+
+				if other, ok := handles[names.Handle]; ok {
+					t.Errorf("%s and %s have the same handle %s", other, pair, names.Handle)
+				}
+				handles[names.Handle] = pair
+
+				if other, ok := volumes[names.Volume]; ok {
+					t.Errorf("%s and %s have the same volume %s", other, pair, names.Volume)
+				}
+				volumes[names.Volume] = pair
+			}
+		}
+	}
+
+	again, err := makeNamedVolumeNames("", "default", "data")
+	if err != nil {
+		t.Fatalf("could not make names - %v", err)
+	}
+
+	if handles[again.Handle] != "default/data" {
+		t.Errorf("names of a claim are not stable, got %s", again.Handle)
+	}
+}
+
+func TestMakeNamedVolumeNamesRejectsInvalidClaims(t *testing.T) {
+	claimNames := []string{
+		"",
+		"Data",
+		"my_data",
+		"-data",
+		"data-",
+		"a.b",
+		"日本",
+		strings.Repeat("c", validation.DNS1123LabelMaxLength+1),
+	}
+
+	for _, claimName := range claimNames {
+		_, err := makeNamedVolumeNames("", "default", claimName)
+		if err == nil {
+			t.Errorf("expected claim name %q to be rejected", claimName)
+		}
+	}
+}
+
+func TestValidateVolumeNamePrefix(t *testing.T) {
+	testCases := []struct {
+		prefix string
+		valid  bool
+	}{
+		{DefaultVolumeNamePrefix, true},
+		{"a", true},
+		{"x-1", true},
+		{strings.Repeat("p", MaxVolumeNamePrefixLen), true},
+		{strings.Repeat("p", MaxVolumeNamePrefixLen+1), false},
+		{"", false},
+		{"Parcel", false},
+		{"-parcel", false},
+		{"parcel-", false},
+		{"par_cel", false},
+		{"日本", false},
+	}
+
+	for _, testCase := range testCases {
+		err := ValidateVolumeNamePrefix(testCase.prefix)
+		if testCase.valid && err != nil {
+			t.Errorf("expected prefix %q to be valid, got %v", testCase.prefix, err)
+		}
+
+		if !testCase.valid && err == nil {
+			t.Errorf("expected prefix %q to be rejected", testCase.prefix)
+		}
+	}
+}
@@ -15,15 +15,12 @@ package kubernetes
 
 import (
 	"fmt"
-	"log"
 	"net/url"
 	"path/filepath"
-	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
-	"github.com/lithammer/shortuuid/v3"
+	"github.com/iychoi/parcel/pkg/catalog"
 	apiv1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	resourcev1 "k8s.io/apimachinery/pkg/api/resource"
@@ -43,6 +40,11 @@ const (
 
 	// VolumeNamespace is a default namespace
 	VolumeNamespace = "default"
+
+	// ClientTypeWebDAV is a CSI client type mounting datasets over WebDAV
+	ClientTypeWebDAV = "webdav"
+	// ClientTypeIRODSFuse is a CSI client type mounting datasets over iRODS
+	ClientTypeIRODSFuse = "irodsfuse"
 )
 
 // DatasetMount holds a volume mapping
@@ -50,6 +52,22 @@ type DatasetMount struct {
 	Dataset               *dataset.Dataset
 	PersistentVolume      *apiv1.PersistentVolume
 	PersistentVolumeClaim *apiv1.PersistentVolumeClaim
+	// CatalogURL is a URL of the catalog the dataset was ordered from, empty for volumes of older versions
+	CatalogURL string
+}
+
+// VolumeOptions holds options of a new volume
+type VolumeOptions struct {
+	// Capacity is a size of the dataset in bytes, 0 for the default capacity
+	Capacity int64
+	// ClaimName is a name of the claim, a name is made from the dataset name if empty
+	ClaimName string
+	// NamePrefix is a prefix of the volume name, DefaultVolumeNamePrefix if empty
+	NamePrefix string
+	// CatalogURL is a URL of the catalog the dataset is ordered from, kept in annotations
+	CatalogURL string
+	// New does not reuse a bound volume of the dataset, see FindReusableVolume
+	New bool
 }
 
 // ParcelVolumeManager manages parcel volume
@@ -114,29 +132,51 @@ func (manager *ParcelVolumeManager) CreateStorageClass() error {
 	return nil
 }
 
-// CreateVolume creates a Persistent Volume for Kubernetes
-func (manager *ParcelVolumeManager) CreateVolume(ds *dataset.Dataset) (*DatasetMount, error) {
-	volumeName := makePersistentVolumeName(ds)
-	pv, err := makePersistentVolume(ds, volumeName)
+// CreateVolume creates a Persistent Volume and its claim for Kubernetes
+// If the claim cannot be created, the volume is deleted so that nothing is left behind
+func (manager *ParcelVolumeManager) CreateVolume(ds *dataset.Dataset, options *VolumeOptions) (*DatasetMount, error) {
+	if options == nil {
+		options = &VolumeOptions{}
+	}
+
+	capacity := makeStorageCapacity(options.Capacity)
+	var names VolumeNames
+	var err error
+	if len(options.ClaimName) > 0 {
+		names, err = makeNamedVolumeNames(options.NamePrefix, manager.namespace, options.ClaimName)
+	} else {
+		names, err = makeVolumeNames(ds, options.NamePrefix)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	coreClient := manager.clientset.CoreV1()
-	// create a new pv
-	pvCreated, err := coreClient.PersistentVolumes().Create(pv)
+	volumeName := names.Volume
+	pv, err := makePersistentVolume(ds, names, manager.namespace, options.CatalogURL, capacity)
 	if err != nil {
 		return nil, err
 	}
 
-	pvc, err := makePersistentVolumeClaim(ds, volumeName)
+	pvc, err := makePersistentVolumeClaim(ds, names, options.CatalogURL, capacity)
 	if err != nil {
 		return nil, err
 	}
 
+	coreClient := manager.clientset.CoreV1()
+	// create a new pv
+	pvCreated, err := coreClient.PersistentVolumes().Create(pv)
+	if err != nil {
+		return nil, fmt.Errorf("could not create persistent volume %s - %v", volumeName, err)
+	}
+
 	pvcCreated, err := coreClient.PersistentVolumeClaims(manager.namespace).Create(pvc)
 	if err != nil {
-		return nil, err
+		// roll back the pv
+		deleteErr := coreClient.PersistentVolumes().Delete(volumeName, &metav1.DeleteOptions{})
+		if deleteErr != nil {
+			return nil, fmt.Errorf("could not create persistent volume claim %s - %v, and could not roll back persistent volume %s - %v", pvc.GetName(), err, volumeName, deleteErr)
+		}
+		return nil, fmt.Errorf("could not create persistent volume claim %s, persistent volume %s is rolled back - %v", pvc.GetName(), volumeName, err)
 	}
 
 	return &DatasetMount{
@@ -146,6 +186,44 @@ func (manager *ParcelVolumeManager) CreateVolume(ds *dataset.Dataset) (*DatasetM
 	}, nil
 }
 
+// FindReusableVolume returns an existing volume that an order of the dataset can reuse, or nil if there is none
+// With a claim name, the volume of the claim is returned if it holds the dataset.
+// Otherwise a bound volume of the dataset is returned, unless New is set.
+func (manager *ParcelVolumeManager) FindReusableVolume(ds *dataset.Dataset, options *VolumeOptions) (*DatasetMount, error) {
+	if options == nil {
+		options = &VolumeOptions{}
+	}
+
+	mounts, err := manager.ListVolumes()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(options.ClaimName) > 0 {
+		for _, mount := range mounts {
+			if mount.PersistentVolumeClaim.GetName() != options.ClaimName {
+				continue
+			}
+
+			if !isSameDataset(mount.Dataset, ds) {
+				return nil, fmt.Errorf("claim %s holds another dataset [%s] %s", options.ClaimName, catalog.GetDatasetRef(mount.Dataset), mount.Dataset.Name)
+			}
+
+			if options.New {
+				return nil, fmt.Errorf("claim %s already exists", options.ClaimName)
+			}
+			return mount, nil
+		}
+	} else if !options.New {
+		for _, mount := range mounts {
+			if isSameDataset(mount.Dataset, ds) && isBound(mount) {
+				return mount, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
 // ListVolumes lists Persistent Volumes for Kubernetes
 func (manager *ParcelVolumeManager) ListVolumes() ([]*DatasetMount, error) {
 	coreClient := manager.clientset.CoreV1()
@@ -163,43 +241,50 @@ func (manager *ParcelVolumeManager) ListVolumes() ([]*DatasetMount, error) {
 	mounts := []*DatasetMount{}
 
 	for _, pv := range pvList.Items {
+		// copy not to share the loop variable between mounts
+		pv := pv
 
-		dataset := dataset.Dataset{}
-		if checkPersistentVolumeName(&pv) {
-			datasetID, found := pv.Labels["dataset-id"]
-			if !found {
-				continue
-			}
+		if !isParcelVolume(&pv) {
+			continue
+		}
 
-			dataset.ID, err = strconv.ParseInt(datasetID, 10, 64)
-			if err != nil {
-				continue
-			}
+		dataset, err := readDataset(&pv)
+		if err != nil {
+			continue
+		}
 
-			datasetName, found := pv.Labels["dataset-name"]
-			if !found {
-				continue
+		// get pvc
+		for _, pvc := range pvcList.Items {
+			pvc := pvc
+			if isPersistentVolumeClaimOf(&pvc, &pv) {
+				mounts = append(mounts, &DatasetMount{
+					Dataset:               dataset,
+					CatalogURL:            pv.Annotations[catalogURLAnnotation],
+					PersistentVolume:      &pv,
+					PersistentVolumeClaim: &pvc,
+				})
+				break
 			}
+		}
+	}
 
-			dataset.Name = datasetName
+	return mounts, nil
+}
 
-			// get pvc
-			for _, pvc := range pvcList.Items {
-				if pv.Name == pvc.Labels["volume-name"] {
-					mount := DatasetMount{
-						Dataset:               &dataset,
-						PersistentVolume:      &pv,
-						PersistentVolumeClaim: &pvc,
-					}
+// ListDatasetVolumes lists Persistent Volumes of the dataset for Kubernetes
+func (manager *ParcelVolumeManager) ListDatasetVolumes(ds *dataset.Dataset) ([]*DatasetMount, error) {
+	mounts, err := manager.ListVolumes()
+	if err != nil {
+		return nil, err
+	}
 
-					mounts = append(mounts, &mount)
-					break
-				}
-			}
+	datasetMounts := []*DatasetMount{}
+	for _, mount := range mounts {
+		if isSameDataset(mount.Dataset, ds) {
+			datasetMounts = append(datasetMounts, mount)
 		}
 	}
-
-	return mounts, nil
+	return datasetMounts, nil
 }
 
 // GetVolume returns a Persistent Volume for Kubernetes
@@ -215,35 +300,23 @@ func (manager *ParcelVolumeManager) GetVolume(volumeName string) (*DatasetMount,
 		return nil, fmt.Errorf("Could not find pv with name %s", volumeName)
 	}
 
-	pvc, err := coreClient.PersistentVolumeClaims(manager.namespace).Get(makePersistentVolumeClaimName(volumeName), metav1.GetOptions{})
+	pvc, err := coreClient.PersistentVolumeClaims(manager.namespace).Get(getPersistentVolumeClaimName(pv), metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	if pvc.Labels["volume-name"] != volumeName {
+	if !isPersistentVolumeClaimOf(pvc, pv) {
 		return nil, fmt.Errorf("Could not find pvc with name %s", volumeName)
 	}
 
-	dataset := dataset.Dataset{}
-	datasetID, found := pv.Labels["dataset-id"]
-	if !found {
-		return nil, fmt.Errorf("Could not find 'dataset-id' field in a persistent volume")
-	}
-
-	dataset.ID, err = strconv.ParseInt(datasetID, 10, 64)
+	dataset, err := readDataset(pv)
 	if err != nil {
 		return nil, err
 	}
 
-	datasetName, found := pv.Labels["dataset-name"]
-	if !found {
-		return nil, fmt.Errorf("Could not find 'dataset-name' field in a persistent volume")
-	}
-
-	dataset.Name = datasetName
-
 	return &DatasetMount{
-		Dataset:               &dataset,
+		Dataset:               dataset,
+		CatalogURL:            pv.Annotations[catalogURLAnnotation],
 		PersistentVolume:      pv,
 		PersistentVolumeClaim: pvc,
 	}, nil
@@ -253,8 +326,13 @@ func (manager *ParcelVolumeManager) GetVolume(volumeName string) (*DatasetMount,
 func (manager *ParcelVolumeManager) DeleteVolume(volumeName string) error {
 	coreClient := manager.clientset.CoreV1()
 
+	pv, err := coreClient.PersistentVolumes().Get(volumeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
 	// delete pvc
-	err := coreClient.PersistentVolumeClaims(manager.namespace).Delete(makePersistentVolumeClaimName(volumeName), &metav1.DeleteOptions{})
+	err = coreClient.PersistentVolumeClaims(manager.namespace).Delete(getPersistentVolumeClaimName(pv), &metav1.DeleteOptions{})
 	if err != nil {
 		return err
 	}
@@ -268,7 +346,8 @@ func (manager *ParcelVolumeManager) DeleteVolume(volumeName string) error {
 	return nil
 }
 
-func getClient(ds *dataset.Dataset) (string, error) {
+// GetClientType returns a type of CSI client that mounts the dataset, determined by the URL scheme
+func GetClientType(ds *dataset.Dataset) (string, error) {
 	u, err := url.Parse(ds.URL)
 	if err != nil {
 		return "", fmt.Errorf("could not parse URL: %v", err)
@@ -278,51 +357,48 @@ func getClient(ds *dataset.Dataset) (string, error) {
 
 	switch scheme {
 	case "webdav":
-		return "webdav", nil
+		return ClientTypeWebDAV, nil
 	case "davfs":
-		return "webdav", nil
+		return ClientTypeWebDAV, nil
 	case "http":
-		return "webdav", nil
+		return ClientTypeWebDAV, nil
 	case "https":
-		return "webdav", nil
+		return ClientTypeWebDAV, nil
 	case "irods":
-		return "irodsfuse", nil
+		return ClientTypeIRODSFuse, nil
 	default:
 		return "", fmt.Errorf("unknown scheme - %s", scheme)
 	}
 }
 
-func makeLabels(ds *dataset.Dataset, volumeName string) map[string]string {
-	labels := map[string]string{
-		"volume-name":  volumeName,
-		"dataset-id":   strconv.FormatInt(ds.ID, 10),
-		"dataset-name": ds.Name,
+// isParcelVolume checks if the pv is made by parcel
+// Volumes of older versions are recognized by their names.
+func isParcelVolume(pv *apiv1.PersistentVolume) bool {
+	if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csiDriverName {
+		return true
 	}
-	return labels
-}
-
-func checkPersistentVolumeName(pv *apiv1.PersistentVolume) bool {
-	return strings.HasPrefix(pv.Name, "parcel-pv-")
+	return strings.HasPrefix(pv.GetName(), DefaultVolumeNamePrefix+volumeNameInfix)
 }
 
-func makePersistentVolumeName(ds *dataset.Dataset) string {
-	reg, err := regexp.Compile("[^a-zA-Z0-9]+")
-	if err != nil {
-		log.Fatal(err)
+// getPersistentVolumeClaimName returns the name of the claim the pv is bound or reserved for
+func getPersistentVolumeClaimName(pv *apiv1.PersistentVolume) string {
+	if pv.Spec.ClaimRef != nil && len(pv.Spec.ClaimRef.Name) > 0 {
+		return pv.Spec.ClaimRef.Name
 	}
-
-	dsName := reg.ReplaceAllString(ds.Name, "")
-	uuid := shortuuid.New()
-
-	return fmt.Sprintf("parcel-pv-%s-%s", dsName, uuid)
+	// claims of older versions are named after volumes
+	return pv.GetName() + claimNameSuffix
 }
 
-func makePersistentVolumeClaimName(volumeName string) string {
-	return fmt.Sprintf("%s-claim", volumeName)
+// isSameDataset checks if two datasets have the same ID in the same catalog
+func isSameDataset(ds1 *dataset.Dataset, ds2 *dataset.Dataset) bool {
+	return ds1.ID == ds2.ID && ds1.Tags[catalog.SourceCatalogTag] == ds2.Tags[catalog.SourceCatalogTag]
 }
 
-func makePersistentVolumeHandleName(volumeName string) string {
-	return fmt.Sprintf("%s-handle", volumeName)
+// isBound checks if the pv and its claim are bound to each other
+func isBound(mount *DatasetMount) bool {
+	return mount.PersistentVolume.Status.Phase == apiv1.VolumeBound &&
+		mount.PersistentVolumeClaim.Status.Phase == apiv1.ClaimBound &&
+		mount.PersistentVolumeClaim.Spec.VolumeName == mount.PersistentVolume.GetName()
 }
 
 func makeStorageClass() (*storagev1.StorageClass, error) {
@@ -334,22 +410,34 @@ func makeStorageClass() (*storagev1.StorageClass, error) {
 	}, nil
 }
 
-func makePersistentVolume(ds *dataset.Dataset, volumeName string) (*apiv1.PersistentVolume, error) {
-	client, err := getClient(ds)
+// makeStorageCapacity returns a capacity of the size rounded up to MiB, or the default capacity if the size is unknown
+func makeStorageCapacity(size int64) resourcev1.Quantity {
+	if size <= 0 {
+		return defaultStorageCapacity
+	}
+
+	const mebibyte = 1024 * 1024
+	mebibytes := (size + mebibyte - 1) / mebibyte
+	return *resourcev1.NewQuantity(mebibytes*mebibyte, resourcev1.BinarySI)
+}
+
+func makePersistentVolume(ds *dataset.Dataset, names VolumeNames, namespace string, catalogURL string, capacity resourcev1.Quantity) (*apiv1.PersistentVolume, error) {
+	client, err := GetClientType(ds)
 	if err != nil {
 		return nil, err
 	}
 
-	labels := makeLabels(ds, volumeName)
+	labels := makeLabels(ds, names.Volume)
 	volmode := apiv1.PersistentVolumeFilesystem
 	return &apiv1.PersistentVolume{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   volumeName,
-			Labels: labels,
+			Name:        names.Volume,
+			Labels:      labels,
+			Annotations: makeAnnotations(ds, catalogURL),
 		},
 		Spec: apiv1.PersistentVolumeSpec{
 			Capacity: apiv1.ResourceList{
-				apiv1.ResourceStorage: defaultStorageCapacity,
+				apiv1.ResourceStorage: capacity,
 			},
 			VolumeMode: &volmode,
 			AccessModes: []apiv1.PersistentVolumeAccessMode{
@@ -358,10 +446,15 @@ func makePersistentVolume(ds *dataset.Dataset, volumeName string) (*apiv1.Persis
 			//PersistentVolumeReclaimPolicy: apiv1.PersistentVolumeReclaimDelete,
 			PersistentVolumeReclaimPolicy: apiv1.PersistentVolumeReclaimRetain,
 			StorageClassName:              csiDriverStorageClassName,
+			// reserve the pv for the claim
+			ClaimRef: &apiv1.ObjectReference{
+				Namespace: namespace,
+				Name:      names.Claim,
+			},
 			PersistentVolumeSource: apiv1.PersistentVolumeSource{
 				CSI: &apiv1.CSIPersistentVolumeSource{
 					Driver:       csiDriverName,
-					VolumeHandle: makePersistentVolumeHandleName(volumeName),
+					VolumeHandle: names.Handle,
 					VolumeAttributes: map[string]string{
 						"client": client,
 						"url":    ds.URL,
@@ -373,14 +466,15 @@ func makePersistentVolume(ds *dataset.Dataset, volumeName string) (*apiv1.Persis
 	}, nil
 }
 
-func makePersistentVolumeClaim(ds *dataset.Dataset, volumeName string) (*apiv1.PersistentVolumeClaim, error) {
-	labels := makeLabels(ds, volumeName)
+func makePersistentVolumeClaim(ds *dataset.Dataset, names VolumeNames, catalogURL string, capacity resourcev1.Quantity) (*apiv1.PersistentVolumeClaim, error) {
+	labels := makeLabels(ds, names.Volume)
 	storageclassname := csiDriverStorageClassName
 
 	return &apiv1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   makePersistentVolumeClaimName(volumeName),
-			Labels: labels,
+			Name:        names.Claim,
+			Labels:      labels,
+			Annotations: makeAnnotations(ds, catalogURL),
 		},
 		Spec: apiv1.PersistentVolumeClaimSpec{
 			AccessModes: []apiv1.PersistentVolumeAccessMode{
@@ -392,7 +486,7 @@ func makePersistentVolumeClaim(ds *dataset.Dataset, volumeName string) (*apiv1.P
 			},
 			Resources: apiv1.ResourceRequirements{
 				Requests: apiv1.ResourceList{
-					apiv1.ResourceStorage: defaultStorageCapacity,
+					apiv1.ResourceStorage: capacity,
 				},
 			},
 		},
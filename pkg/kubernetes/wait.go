@@ -0,0 +1,269 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	// DefaultBindingTimeout is a default time to wait for a volume and its claim to be bound
+	DefaultBindingTimeout = 2 * time.Minute
+)
+
+var (
+	// ErrNotBound is returned when a volume and its claim are not bound in time, or cannot be bound
+	ErrNotBound = errors.New("volume is not bound")
+)
+
+// BindingStatus is a status of a volume and its claim
+type BindingStatus struct {
+	VolumePhase apiv1.PersistentVolumePhase
+	ClaimPhase  apiv1.PersistentVolumeClaimPhase
+	Elapsed     time.Duration
+}
+
+// String returns phases of the volume and the claim
+func (status BindingStatus) String() string {
+	return fmt.Sprintf("volume %s, claim %s", formatPhase(string(status.VolumePhase)), formatPhase(string(status.ClaimPhase)))
+}
+
+func formatPhase(phase string) string {
+	if len(phase) == 0 {
+		return "Unknown"
+	}
+	return phase
+}
+
+// BindingError describes a volume that is not bound, with Kubernetes events of the volume and the claim
+type BindingError struct {
+	VolumeName string
+	ClaimName  string
+	Status     BindingStatus
+	Reason     string
+	Events     []string
+}
+
+func (e *BindingError) Error() string {
+	return fmt.Sprintf("%s - %s (%s)", ErrNotBound, e.Reason, e.Status)
+}
+
+// Unwrap returns ErrNotBound
+func (e *BindingError) Unwrap() error {
+	return ErrNotBound
+}
+
+// WaitForBinding watches the volume and its claim until both are bound, and returns them updated
+// onStatus is called with the initial status and on every change, it may be nil.
+// It returns a BindingError if they are not bound in the timeout, or if the volume fails.
+func (manager *ParcelVolumeManager) WaitForBinding(ctx context.Context, mount *DatasetMount, timeout time.Duration, onStatus func(BindingStatus)) (*DatasetMount, error) {
+	if timeout <= 0 {
+		timeout = DefaultBindingTimeout
+	}
+
+	start := time.Now()
+	pv := mount.PersistentVolume
+	pvc := mount.PersistentVolumeClaim
+
+	var pvWatch watch.Interface
+	var pvcWatch watch.Interface
+	defer func() {
+		if pvWatch != nil {
+			pvWatch.Stop()
+		}
+		if pvcWatch != nil {
+			pvcWatch.Stop()
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	lastStatus := BindingStatus{}
+	for {
+		status := BindingStatus{
+			VolumePhase: pv.Status.Phase,
+			ClaimPhase:  pvc.Status.Phase,
+			Elapsed:     time.Since(start),
+		}
+
+		if onStatus != nil && (status.VolumePhase != lastStatus.VolumePhase || status.ClaimPhase != lastStatus.ClaimPhase) {
+			onStatus(status)
+		}
+		lastStatus = status
+
+		updated := &DatasetMount{
+			Dataset:               mount.Dataset,
+			PersistentVolume:      pv,
+			PersistentVolumeClaim: pvc,
+		}
+
+		if isBound(updated) {
+			return updated, nil
+		}
+
+		if pv.Status.Phase == apiv1.VolumeFailed || pvc.Status.Phase == apiv1.ClaimLost {
+			return nil, manager.newBindingError(pv, pvc, status, "volume cannot be bound")
+		}
+
+		// (re)open watches, they are closed by the server from time to time
+		var err error
+		if pvWatch == nil {
+			pv, pvWatch, err = manager.watchPersistentVolume(pv.GetName())
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if pvcWatch == nil {
+			pvc, pvcWatch, err = manager.watchPersistentVolumeClaim(pvc.GetName())
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			return nil, manager.newBindingError(pv, pvc, status, fmt.Sprintf("not bound in %s", timeout))
+		case event, ok := <-pvWatch.ResultChan():
+			if !ok || event.Type == watch.Error {
+				pvWatch.Stop()
+				pvWatch = nil
+				continue
+			}
+
+			if event.Type == watch.Deleted {
+				return nil, manager.newBindingError(pv, pvc, status, "volume is deleted")
+			}
+
+			if updatedPV, ok := event.Object.(*apiv1.PersistentVolume); ok {
+				pv = updatedPV
+			}
+		case event, ok := <-pvcWatch.ResultChan():
+			if !ok || event.Type == watch.Error {
+				pvcWatch.Stop()
+				pvcWatch = nil
+				continue
+			}
+
+			if event.Type == watch.Deleted {
+				return nil, manager.newBindingError(pv, pvc, status, "claim is deleted")
+			}
+
+			if updatedPVC, ok := event.Object.(*apiv1.PersistentVolumeClaim); ok {
+				pvc = updatedPVC
+			}
+		}
+	}
+}
+
+// watchPersistentVolume returns the current pv and a watch of its changes
+func (manager *ParcelVolumeManager) watchPersistentVolume(volumeName string) (*apiv1.PersistentVolume, watch.Interface, error) {
+	coreClient := manager.clientset.CoreV1()
+	pv, err := coreClient.PersistentVolumes().Get(volumeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pvWatch, err := coreClient.PersistentVolumes().Watch(metav1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", volumeName).String(),
+		ResourceVersion: pv.GetResourceVersion(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pv, pvWatch, nil
+}
+
+// watchPersistentVolumeClaim returns the current pvc and a watch of its changes
+func (manager *ParcelVolumeManager) watchPersistentVolumeClaim(claimName string) (*apiv1.PersistentVolumeClaim, watch.Interface, error) {
+	coreClient := manager.clientset.CoreV1()
+	pvc, err := coreClient.PersistentVolumeClaims(manager.namespace).Get(claimName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pvcWatch, err := coreClient.PersistentVolumeClaims(manager.namespace).Watch(metav1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", claimName).String(),
+		ResourceVersion: pvc.GetResourceVersion(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pvc, pvcWatch, nil
+}
+
+func (manager *ParcelVolumeManager) newBindingError(pv *apiv1.PersistentVolume, pvc *apiv1.PersistentVolumeClaim, status BindingStatus, reason string) *BindingError {
+	return &BindingError{
+		VolumeName: pv.GetName(),
+		ClaimName:  pvc.GetName(),
+		Status:     status,
+		Reason:     reason,
+		Events:     manager.listEvents(pv, pvc),
+	}
+}
+
+// listEvents returns events of the pv and the pvc, oldest first
+// Events of cluster-wide objects such as pvs are recorded in the default namespace
+func (manager *ParcelVolumeManager) listEvents(pv *apiv1.PersistentVolume, pvc *apiv1.PersistentVolumeClaim) []string {
+	coreClient := manager.clientset.CoreV1()
+
+	events := []apiv1.Event{}
+	targets := []struct {
+		namespace string
+		kind      string
+		name      string
+	}{
+		{metav1.NamespaceDefault, "PersistentVolume", pv.GetName()},
+		{manager.namespace, "PersistentVolumeClaim", pvc.GetName()},
+	}
+
+	for _, target := range targets {
+		eventList, err := coreClient.Events(target.namespace).List(metav1.ListOptions{
+			FieldSelector: fields.Set{
+				"involvedObject.kind": target.kind,
+				"involvedObject.name": target.name,
+			}.String(),
+		})
+		if err != nil {
+			// events are best effort
+			continue
+		}
+		events = append(events, eventList.Items...)
+	}
+
+	sort.SliceStable(events, func(i int, j int) bool {
+		return events[i].LastTimestamp.Before(&events[j].LastTimestamp)
+	})
+
+	messages := []string{}
+	for _, event := range events {
+		messages = append(messages, fmt.Sprintf("%s %s %s: %s", event.Type, event.InvolvedObject.Kind, event.Reason, strings.TrimSpace(event.Message)))
+	}
+	return messages
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/iychoi/parcel/pkg/probe"
+)
+
+const (
+	// DefaultHistory is a default number of checks kept per dataset
+	DefaultHistory = 100
+
+	stateFileName = "monitor.json"
+)
+
+// Check is a result of a reachability check
+type Check struct {
+	Time    time.Time     `json:"time"`
+	OK      bool          `json:"ok"`
+	Latency time.Duration `json:"latency"`
+	Stage   string        `json:"stage,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// DatasetHealth is a rolling history of checks of a dataset
+type DatasetHealth struct {
+	Ref    string  `json:"ref"`
+	Name   string  `json:"name"`
+	URL    string  `json:"url"`
+	Checks []Check `json:"checks"`
+	// FailingSince is the time of the first failed check after the last successful one, zero if the last check succeeded
+	FailingSince time.Time `json:"failingSince,omitempty"`
+}
+
+// State holds health of datasets, saved in a local file
+type State struct {
+	path     string
+	Datasets map[string]*DatasetHealth `json:"datasets"`
+}
+
+// GetDefaultStatePath returns a state file path under the cache dir
+func GetDefaultStatePath(cacheDir string) string {
+	return filepath.Join(cacheDir, stateFileName)
+}
+
+// LoadState reads state from the file, a missing file gives an empty state
+func LoadState(path string) (*State, error) {
+	state := &State{
+		path:     path,
+		Datasets: map[string]*DatasetHealth{},
+	}
+
+	jsonBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(jsonBytes, state)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse monitor state file %s - %v", path, err)
+	}
+
+	if state.Datasets == nil {
+		state.Datasets = map[string]*DatasetHealth{}
+	}
+	return state, nil
+}
+
+// Save writes state to the file
+func (state *State) Save() error {
+	err := os.MkdirAll(filepath.Dir(state.path), 0700)
+	if err != nil {
+		return err
+	}
+
+	jsonBytes, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tempPath := fmt.Sprintf("%s.tmp", state.path)
+	err = ioutil.WriteFile(tempPath, jsonBytes, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempPath, state.path)
+}
+
+// Record adds a probe result of a dataset, keeping up to history checks
+// History of a dataset is reset if its URL has changed
+func (state *State) Record(ref string, name string, result *probe.Result, checkedAt time.Time, history int) *DatasetHealth {
+	if history <= 0 {
+		history = DefaultHistory
+	}
+
+	health, ok := state.Datasets[ref]
+	if !ok || health.URL != result.URL {
+		health = &DatasetHealth{
+			Ref: ref,
+			URL: result.URL,
+		}
+		state.Datasets[ref] = health
+	}
+	health.Name = name
+
+	check := Check{
+		Time:    checkedAt,
+		OK:      result.OK(),
+		Latency: result.DNSLatency + result.ConnectLatency + result.RequestLatency,
+	}
+
+	if result.OK() {
+		health.FailingSince = time.Time{}
+	} else {
+		check.Stage = result.FailedStage
+		check.Error = result.Err.Error()
+		if health.FailingSince.IsZero() {
+			health.FailingSince = checkedAt
+		}
+	}
+
+	health.Checks = append(health.Checks, check)
+	if len(health.Checks) > history {
+		health.Checks = health.Checks[len(health.Checks)-history:]
+	}
+	return health
+}
+
+// LastCheck returns the last check, or nil if there are none
+func (health *DatasetHealth) LastCheck() *Check {
+	if len(health.Checks) == 0 {
+		return nil
+	}
+	return &health.Checks[len(health.Checks)-1]
+}
+
+// Availability returns a ratio of successful checks in the history
+func (health *DatasetHealth) Availability() float64 {
+	if len(health.Checks) == 0 {
+		return 0
+	}
+
+	ok := 0
+	for _, check := range health.Checks {
+		if check.OK {
+			ok++
+		}
+	}
+	return float64(ok) / float64(len(health.Checks))
+}
+
+// AverageLatency returns an average latency of successful checks in the history
+func (health *DatasetHealth) AverageLatency() time.Duration {
+	total := time.Duration(0)
+	ok := 0
+	for _, check := range health.Checks {
+		if check.OK {
+			total += check.Latency
+			ok++
+		}
+	}
+
+	if ok == 0 {
+		return 0
+	}
+	return total / time.Duration(ok)
+}
+
+// FailingFor returns how long the dataset has been unreachable, zero if it is reachable
+func (health *DatasetHealth) FailingFor(now time.Time) time.Duration {
+	if health.FailingSince.IsZero() {
+		return 0
+	}
+	return now.Sub(health.FailingSince)
+}
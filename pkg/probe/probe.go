@@ -0,0 +1,243 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/iychoi/parcel/pkg/webdav"
+)
+
+// stages of a probe
+const (
+	StageParse   = "parse"
+	StageDNS     = "dns"
+	StageConnect = "connect"
+	StageRequest = "request"
+)
+
+const (
+	// DefaultTimeout is a default timeout of each stage of a probe
+	DefaultTimeout = 10 * time.Second
+
+	defaultIRODSPort = "1247"
+)
+
+// Result is a result of probing a dataset URL
+// Latencies of stages that are not reached are zero
+type Result struct {
+	URL            string
+	DNSLatency     time.Duration
+	ConnectLatency time.Duration
+	RequestLatency time.Duration
+	// Proxy is a proxy the request goes through, DNS and connect stages are skipped if it is set
+	Proxy string
+	// FailedStage is the stage that failed, empty if the URL is reachable
+	FailedStage string
+	Err         error
+}
+
+// OK checks if the URL is reachable
+func (result *Result) OK() bool {
+	return result.Err == nil
+}
+
+// String returns a summary of latencies and the failure
+func (result *Result) String() string {
+	latencies := []string{}
+	if result.DNSLatency > 0 {
+		latencies = append(latencies, fmt.Sprintf("dns %s", roundLatency(result.DNSLatency)))
+	}
+	if result.ConnectLatency > 0 {
+		latencies = append(latencies, fmt.Sprintf("connect %s", roundLatency(result.ConnectLatency)))
+	}
+	if result.RequestLatency > 0 {
+		latencies = append(latencies, fmt.Sprintf("request %s", roundLatency(result.RequestLatency)))
+	}
+
+	if len(result.Proxy) > 0 {
+		latencies = append(latencies, fmt.Sprintf("via proxy %s", result.Proxy))
+	}
+
+	if result.OK() {
+		return fmt.Sprintf("OK (%s)", strings.Join(latencies, ", "))
+	}
+
+	if len(latencies) == 0 {
+		return fmt.Sprintf("FAILED at %s - %v", result.FailedStage, result.Err)
+	}
+	return fmt.Sprintf("FAILED at %s - %v (%s)", result.FailedStage, result.Err, strings.Join(latencies, ", "))
+}
+
+func roundLatency(latency time.Duration) time.Duration {
+	if latency < time.Millisecond {
+		return latency.Round(time.Microsecond)
+	}
+	return latency.Round(time.Millisecond)
+}
+
+// Probe checks that a dataset URL is reachable
+// It resolves the host and connects to it, then issues a PROPFIND (or HEAD) for WebDAV URLs.
+// iRODS URLs are only checked with a TCP connection.
+// If HTTP_PROXY, HTTPS_PROXY or NO_PROXY send a WebDAV URL through a proxy, only the request is checked.
+func Probe(ctx context.Context, datasetURL string, timeout time.Duration) *Result {
+	result := &Result{
+		URL: datasetURL,
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	u, err := url.Parse(datasetURL)
+	if err != nil {
+		return result.fail(StageParse, err)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	port := u.Port()
+	switch scheme {
+	case "http":
+		if len(port) == 0 {
+			port = "80"
+		}
+	case "https", "webdav", "davfs":
+		// webdav and davfs are served over https
+		if len(port) == 0 {
+			port = "443"
+		}
+	case "irods":
+		if len(port) == 0 {
+			port = defaultIRODSPort
+		}
+	default:
+		return result.fail(StageParse, fmt.Errorf("unknown scheme - %s", u.Scheme))
+	}
+
+	host := u.Hostname()
+	if len(host) == 0 {
+		return result.fail(StageParse, fmt.Errorf("URL has no host"))
+	}
+
+	if scheme != "irods" {
+		proxyURL, err := getProxyURL(datasetURL)
+		if err != nil {
+			return result.fail(StageParse, err)
+		}
+
+		if proxyURL != nil {
+			// the host may not be resolvable or reachable from here, only the proxy connects to it
+			result.Proxy = proxyURL.Host
+			return result.request(ctx, datasetURL, timeout)
+		}
+	}
+
+	// dns
+	dnsCtx, cancel := context.WithTimeout(ctx, timeout)
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(dnsCtx, host)
+	cancel()
+	result.DNSLatency = time.Since(start)
+	if err != nil {
+		return result.fail(StageDNS, err)
+	}
+
+	// connect
+	start = time.Now()
+	err = connect(ctx, addrs, port, timeout)
+	result.ConnectLatency = time.Since(start)
+	if err != nil {
+		return result.fail(StageConnect, err)
+	}
+
+	if scheme == "irods" {
+		return result
+	}
+	return result.request(ctx, datasetURL, timeout)
+}
+
+// connect tries addresses in turn until a TCP connection is made
+// A host is reachable if any of its addresses is, e.g. when an IPv6 address comes first but only IPv4 is routed.
+func connect(ctx context.Context, addrs []string, port string, timeout time.Duration) error {
+	dialer := net.Dialer{
+		Timeout: timeout,
+	}
+
+	var lastErr error
+	errs := []string{}
+	for _, addr := range addrs {
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(addr, port))
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		lastErr = err
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) == 1 {
+		return lastErr
+	}
+	return fmt.Errorf("none of %d addresses is reachable - %s", len(addrs), strings.Join(errs, "; "))
+}
+
+// getProxyURL returns a proxy of the dataset URL set by environment variables, or nil if it is connected directly
+func getProxyURL(datasetURL string) (*url.URL, error) {
+	httpURL, err := webdav.GetHTTPURL(datasetURL)
+	if err != nil {
+		return nil, err
+	}
+
+	proxyURL, err := http.ProxyFromEnvironment(&http.Request{
+		URL: httpURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy setting - %v", err)
+	}
+	return proxyURL, nil
+}
+
+// request issues a PROPFIND (or HEAD) to the dataset URL
+func (result *Result) request(ctx context.Context, datasetURL string, timeout time.Duration) *Result {
+	client, err := webdav.NewClient(datasetURL, &webdav.ClientOptions{
+		Timeout: timeout,
+	})
+	if err != nil {
+		return result.fail(StageRequest, err)
+	}
+
+	start := time.Now()
+	err = client.Check(ctx)
+	result.RequestLatency = time.Since(start)
+	if err != nil {
+		return result.fail(StageRequest, err)
+	}
+	return result
+}
+
+func (result *Result) fail(stage string, err error) *Result {
+	result.FailedStage = stage
+	result.Err = err
+	return result
+}
@@ -0,0 +1,369 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package query
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+)
+
+const (
+	// MinSubstringLen is the min length of a term matched anywhere in text
+	// Shorter terms, e.g. RNA or GEO, only match whole words
+	MinSubstringLen = 4
+)
+
+var (
+	// fieldWeights gives a relevance score of a term found in a field
+	fieldWeights = map[string]float64{
+		FieldID:          5,
+		FieldName:        3,
+		FieldDescription: 1,
+		FieldCreator:     1,
+		FieldHost:        1,
+		FieldRights:      1,
+		FieldURL:         1,
+		FieldScheme:      1,
+		FieldTag:         1,
+	}
+
+	// textFields are fields searched by terms without a field
+	textFields = []string{
+		FieldName,
+		FieldDescription,
+		FieldCreator,
+		FieldHost,
+		FieldRights,
+		FieldURL,
+		FieldTag,
+	}
+)
+
+// ScoredDataset is a dataset matching a query with its relevance score
+type ScoredDataset struct {
+	Dataset *dataset.Dataset
+	Score   float64
+}
+
+type node interface {
+	// eval checks if the dataset matches, and returns a relevance score
+	eval(ds *dataset.Dataset) (bool, float64)
+	// collectTerms collects terms that must be highlighted
+	collectTerms(terms *[]*termNode)
+	// collectKeywords collects plain keywords, it returns false if they cannot narrow down datasets
+	collectKeywords(keywords *[]string) bool
+}
+
+type andNode struct {
+	children []node
+}
+
+type orNode struct {
+	children []node
+}
+
+type notNode struct {
+	child node
+}
+
+type termNode struct {
+	field  string
+	value  string
+	phrase bool
+}
+
+// textRange is a matched range of text in bytes
+type textRange struct {
+	start int
+	end   int
+}
+
+// Match checks if the dataset matches the query, and returns a relevance score
+func (query *Query) Match(ds *dataset.Dataset) (bool, float64) {
+	if query.root == nil {
+		return true, 0
+	}
+	return query.root.eval(ds)
+}
+
+// Rank returns datasets matching the query, the most relevant first
+// Datasets with the same score keep their order
+func (query *Query) Rank(datasets []*dataset.Dataset) []ScoredDataset {
+	scored := []ScoredDataset{}
+	for _, ds := range datasets {
+		if matched, score := query.Match(ds); matched {
+			scored = append(scored, ScoredDataset{
+				Dataset: ds,
+				Score:   score,
+			})
+		}
+	}
+
+	sort.SliceStable(scored, func(i int, j int) bool {
+		return scored[i].Score > scored[j].Score
+	})
+	return scored
+}
+
+// Highlight marks text of the field matching terms of the query
+// Terms under NOT are not marked
+func (query *Query) Highlight(field string, text string, mark func(string) string) string {
+	if query.root == nil || len(text) == 0 {
+		return text
+	}
+
+	terms := []*termNode{}
+	query.root.collectTerms(&terms)
+
+	ranges := []textRange{}
+	for _, term := range terms {
+		if term.field != "" && term.field != field {
+			continue
+		}
+
+		if term.field == FieldScheme || term.field == FieldID {
+			continue
+		}
+		ranges = append(ranges, findTerm(text, term.value)...)
+	}
+
+	if len(ranges) == 0 {
+		return text
+	}
+
+	ranges = mergeRanges(ranges)
+
+	sb := strings.Builder{}
+	last := 0
+	for _, r := range ranges {
+		sb.WriteString(text[last:r.start])
+		sb.WriteString(mark(text[r.start:r.end]))
+		last = r.end
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+func (n *andNode) eval(ds *dataset.Dataset) (bool, float64) {
+	total := 0.0
+	for _, child := range n.children {
+		matched, score := child.eval(ds)
+		if !matched {
+			return false, 0
+		}
+		total += score
+	}
+	return true, total
+}
+
+func (n *andNode) collectTerms(terms *[]*termNode) {
+	for _, child := range n.children {
+		child.collectTerms(terms)
+	}
+}
+
+func (n *andNode) collectKeywords(keywords *[]string) bool {
+	for _, child := range n.children {
+		if !child.collectKeywords(keywords) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *orNode) eval(ds *dataset.Dataset) (bool, float64) {
+	matchedAny := false
+	total := 0.0
+	for _, child := range n.children {
+		matched, score := child.eval(ds)
+		if matched {
+			matchedAny = true
+			total += score
+		}
+	}
+	return matchedAny, total
+}
+
+func (n *orNode) collectTerms(terms *[]*termNode) {
+	for _, child := range n.children {
+		child.collectTerms(terms)
+	}
+}
+
+func (n *orNode) collectKeywords(keywords *[]string) bool {
+	for _, child := range n.children {
+		if !child.collectKeywords(keywords) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *notNode) eval(ds *dataset.Dataset) (bool, float64) {
+	matched, _ := n.child.eval(ds)
+	return !matched, 0
+}
+
+func (n *notNode) collectTerms(terms *[]*termNode) {
+}
+
+func (n *notNode) collectKeywords(keywords *[]string) bool {
+	return false
+}
+
+func (n *termNode) eval(ds *dataset.Dataset) (bool, float64) {
+	if n.field != "" {
+		count := n.countInField(ds, n.field)
+		return count > 0, float64(count) * fieldWeights[n.field]
+	}
+
+	matched := false
+	total := 0.0
+	if n.countInField(ds, FieldID) > 0 {
+		matched = true
+		total += fieldWeights[FieldID]
+	}
+
+	for _, field := range textFields {
+		count := n.countInField(ds, field)
+		if count > 0 {
+			matched = true
+			total += float64(count) * fieldWeights[field]
+		}
+	}
+	return matched, total
+}
+
+func (n *termNode) collectTerms(terms *[]*termNode) {
+	*terms = append(*terms, n)
+}
+
+// collectKeywords returns false for terms Catalog Service cannot match in the same way
+func (n *termNode) collectKeywords(keywords *[]string) bool {
+	if n.field != "" || n.phrase || utf8.RuneCountInString(n.value) < MinSubstringLen {
+		return false
+	}
+
+	*keywords = append(*keywords, n.value)
+	return true
+}
+
+// countInField returns the number of occurrences of the term in the field
+func (n *termNode) countInField(ds *dataset.Dataset, field string) int {
+	switch field {
+	case FieldID:
+		if strconv.FormatInt(ds.ID, 10) == n.value {
+			return 1
+		}
+		return 0
+	case FieldScheme:
+		u, err := url.Parse(ds.URL)
+		if err == nil && strings.EqualFold(u.Scheme, n.value) {
+			return 1
+		}
+		return 0
+	case FieldTag:
+		count := 0
+		for _, v := range ds.Tags {
+			count += len(findTerm(v, n.value))
+		}
+		return count
+	default:
+		return len(findTerm(GetFieldText(ds, field), n.value))
+	}
+}
+
+// GetFieldText returns text of a field of the dataset
+func GetFieldText(ds *dataset.Dataset, field string) string {
+	switch field {
+	case FieldName:
+		return ds.Name
+	case FieldDescription:
+		return ds.Description
+	case FieldCreator:
+		return ds.Creator
+	case FieldHost:
+		return ds.Host
+	case FieldRights:
+		return ds.Rights
+	case FieldURL:
+		return ds.URL
+	default:
+		return ""
+	}
+}
+
+// findTerm finds case-insensitive occurrences of the term in text
+// Terms shorter than MinSubstringLen must be whole words
+func findTerm(text string, term string) []textRange {
+	ranges := []textRange{}
+	if len(term) == 0 || len(term) > len(text) {
+		return ranges
+	}
+
+	wholeWord := utf8.RuneCountInString(term) < MinSubstringLen
+	for i := 0; i+len(term) <= len(text); i++ {
+		if !utf8.RuneStart(text[i]) || !strings.EqualFold(text[i:i+len(term)], term) {
+			continue
+		}
+
+		if wholeWord && !(isWordBoundary(text, i) && isWordBoundary(text, i+len(term))) {
+			continue
+		}
+
+		ranges = append(ranges, textRange{start: i, end: i + len(term)})
+		i += len(term) - 1
+	}
+	return ranges
+}
+
+// isWordBoundary checks if the position is not between two letters or digits
+func isWordBoundary(text string, pos int) bool {
+	if pos == 0 || pos == len(text) {
+		return true
+	}
+
+	before, _ := utf8.DecodeLastRuneInString(text[:pos])
+	after, _ := utf8.DecodeRuneInString(text[pos:])
+	return !isWordRune(before) || !isWordRune(after)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func mergeRanges(ranges []textRange) []textRange {
+	sort.Slice(ranges, func(i int, j int) bool {
+		return ranges[i].start < ranges[j].start
+	})
+
+	merged := []textRange{ranges[0]}
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.start <= last.end {
+			if r.end > last.end {
+				last.end = r.end
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
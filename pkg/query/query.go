@@ -0,0 +1,393 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// fields that terms can be scoped to, e.g. name:genome
+const (
+	FieldID          = "id"
+	FieldName        = "name"
+	FieldDescription = "description"
+	FieldCreator     = "creator"
+	FieldHost        = "host"
+	FieldRights      = "rights"
+	FieldURL         = "url"
+	FieldScheme      = "scheme"
+	FieldTag         = "tag"
+)
+
+// operators, they must be written in upper case
+const (
+	operatorAnd = "AND"
+	operatorOr  = "OR"
+	operatorNot = "NOT"
+)
+
+var (
+	knownFields = map[string]bool{
+		FieldID:          true,
+		FieldName:        true,
+		FieldDescription: true,
+		FieldCreator:     true,
+		FieldHost:        true,
+		FieldRights:      true,
+		FieldURL:         true,
+		FieldScheme:      true,
+		FieldTag:         true,
+	}
+)
+
+// Query is a parsed search expression
+//
+// An expression is made of terms combined with AND, OR, NOT and parentheses.
+// Adjacent terms are combined with AND. A term is a word or a "quoted phrase",
+// optionally scoped to a field, e.g. name:genome or description:"rna seq".
+type Query struct {
+	expression string
+	root       node
+}
+
+type tokenType int
+
+const (
+	tokenTerm tokenType = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	typ    tokenType
+	field  string
+	value  string
+	phrase bool
+}
+
+// Parse parses a search expression, an empty expression matches all datasets
+func Parse(expression string) (*Query, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query '%s' - %v", expression, err)
+	}
+
+	query := &Query{
+		expression: expression,
+	}
+
+	if len(tokens) == 0 {
+		return query, nil
+	}
+
+	p := parser{
+		tokens: tokens,
+	}
+
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected ')'")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid query '%s' - %v", expression, err)
+	}
+
+	query.root = root
+	return query, nil
+}
+
+// JoinArgs joins command-line arguments into an expression
+// Arguments that had quotes removed by the shell are quoted again
+func JoinArgs(args []string) string {
+	parts := []string{}
+	for _, arg := range args {
+		if strings.IndexFunc(arg, unicode.IsSpace) < 0 || strings.Contains(arg, "\"") {
+			parts = append(parts, arg)
+			continue
+		}
+
+		field, value := splitField(arg)
+		if len(field) > 0 {
+			parts = append(parts, fmt.Sprintf("%s:\"%s\"", field, value))
+		} else {
+			parts = append(parts, fmt.Sprintf("\"%s\"", arg))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// String returns the expression
+func (query *Query) String() string {
+	return query.expression
+}
+
+// IsEmpty checks if the query has no terms
+func (query *Query) IsEmpty() bool {
+	return query.root == nil
+}
+
+// Keywords returns plain keywords that a Catalog Service can use to narrow down datasets before the query is applied
+// It returns nil if a dataset may match the query without containing any of the keywords
+func (query *Query) Keywords() []string {
+	if query.root == nil {
+		return nil
+	}
+
+	keywords := []string{}
+	if !query.root.collectKeywords(&keywords) {
+		return nil
+	}
+	return keywords
+}
+
+func tokenize(expression string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(expression)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{typ: tokenOpen})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{typ: tokenClose})
+			i++
+		case r == '"':
+			phrase, next, err := readPhrase(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{typ: tokenTerm, value: phrase, phrase: true})
+			i = next
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != '"' {
+				i++
+			}
+			word := string(runes[start:i])
+
+			switch word {
+			case operatorAnd:
+				tokens = append(tokens, token{typ: tokenAnd})
+				continue
+			case operatorOr:
+				tokens = append(tokens, token{typ: tokenOr})
+				continue
+			case operatorNot:
+				tokens = append(tokens, token{typ: tokenNot})
+				continue
+			}
+
+			field, value := splitField(word)
+			if len(field) == 0 && isFieldLike(word) {
+				return nil, fmt.Errorf("unknown field '%s', use one of %s", word[:strings.Index(word, ":")], strings.Join(getFieldNames(), ", "))
+			}
+
+			if len(field) > 0 && len(value) == 0 && i < len(runes) && runes[i] == '"' {
+				// field:"phrase"
+				phrase, next, err := readPhrase(runes, i)
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, token{typ: tokenTerm, field: field, value: phrase, phrase: true})
+				i = next
+				continue
+			}
+
+			if len(field) > 0 && len(value) == 0 {
+				return nil, fmt.Errorf("field '%s' has no term", field)
+			}
+
+			tokens = append(tokens, token{typ: tokenTerm, field: field, value: value})
+		}
+	}
+	return tokens, nil
+}
+
+// readPhrase reads a quoted phrase starting at the quote, and returns the phrase and the position after the closing quote
+func readPhrase(runes []rune, start int) (string, int, error) {
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] == '"' {
+			phrase := strings.Join(strings.Fields(string(runes[start+1:i])), " ")
+			if len(phrase) == 0 {
+				return "", 0, fmt.Errorf("empty phrase")
+			}
+			return phrase, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated phrase")
+}
+
+// splitField splits field:value, the field is empty if the word is not scoped to a known field
+func splitField(word string) (string, string) {
+	idx := strings.Index(word, ":")
+	if idx < 0 {
+		return "", word
+	}
+
+	field := strings.ToLower(word[:idx])
+	if !knownFields[field] {
+		return "", word
+	}
+	return field, word[idx+1:]
+}
+
+// isFieldLike checks if the word looks like a field-scoped term, e.g. nmae:genome
+func isFieldLike(word string) bool {
+	idx := strings.Index(word, ":")
+	if idx <= 0 {
+		return false
+	}
+
+	rest := word[idx+1:]
+	if strings.HasPrefix(rest, "//") {
+		// URLs
+		return false
+	}
+
+	for _, r := range word[:idx] {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func getFieldNames() []string {
+	names := []string{}
+	for name := range knownFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() *token {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	children := []node{left}
+	for {
+		tok := p.peek()
+		if tok == nil || tok.typ != tokenOr {
+			break
+		}
+		p.pos++
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+
+	if len(children) == 1 {
+		return left, nil
+	}
+	return &orNode{children: children}, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	children := []node{left}
+	for {
+		tok := p.peek()
+		if tok == nil || tok.typ == tokenOr || tok.typ == tokenClose {
+			break
+		}
+
+		if tok.typ == tokenAnd {
+			p.pos++
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+
+	if len(children) == 1 {
+		return left, nil
+	}
+	return &andNode{children: children}, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	tok := p.peek()
+	if tok == nil {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+
+	switch tok.typ {
+	case tokenNot:
+		p.pos++
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{child: child}, nil
+	case tokenOpen:
+		p.pos++
+		child, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		closeTok := p.peek()
+		if closeTok == nil || closeTok.typ != tokenClose {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return child, nil
+	case tokenTerm:
+		p.pos++
+		return &termNode{
+			field:  tok.field,
+			value:  tok.value,
+			phrase: tok.phrase,
+		}, nil
+	case tokenClose:
+		return nil, fmt.Errorf("unexpected ')'")
+	default:
+		return nil, fmt.Errorf("operator without a term")
+	}
+}
@@ -0,0 +1,331 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iychoi/parcel-catalog-service/pkg/dataset"
+)
+
+func mustParse(t *testing.T, expression string) *Query {
+	t.Helper()
+
+	q, err := Parse(expression)
+	if err != nil {
+		t.Fatalf("could not parse '%s' - %v", expression, err)
+	}
+	return q
+}
+
+func markBrackets(text string) string {
+	return "[" + text + "]"
+}
+
+func TestParsePrecedence(t *testing.T) {
+	testCases := []struct {
+		expression string
+		name       string
+		matched    bool
+	}{
+		// AND binds tighter than OR
+		{"alpha OR beta gamma", "alpha", true},
+		{"alpha OR beta gamma", "beta", false},
+		{"alpha OR beta gamma", "beta gamma", true},
+		{"alpha AND beta OR gamma", "gamma", true},
+		{"alpha AND beta OR gamma", "alpha", false},
+		{"alpha AND beta OR gamma", "alpha beta", true},
+		// parentheses group
+		{"(alpha OR beta) gamma", "alpha", false},
+		{"(alpha OR beta) gamma", "alpha gamma", true},
+		{"(alpha OR beta) AND (gamma OR delta)", "beta delta", true},
+		{"(alpha OR beta) AND (gamma OR delta)", "alpha beta", false},
+		{"((alpha))", "alpha", true},
+		// NOT binds tighter than AND
+		{"NOT alpha beta", "beta", true},
+		{"NOT alpha beta", "alpha beta", false},
+		{"NOT (alpha OR beta)", "gamma", true},
+		{"NOT (alpha OR beta)", "beta", false},
+		{"alpha AND NOT beta", "alpha", true},
+		{"alpha AND NOT beta", "alpha beta", false},
+		{"NOT NOT alpha", "alpha", true},
+		// an empty query matches all
+		{"", "anything", true},
+		{"   ", "anything", true},
+	}
+
+	for _, testCase := range testCases {
+		q := mustParse(t, testCase.expression)
+		matched, _ := q.Match(&dataset.Dataset{Name: testCase.name})
+		if matched != testCase.matched {
+			t.Errorf("'%s' on name '%s': expected %v, got %v", testCase.expression, testCase.name, testCase.matched, matched)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	expressions := []string{
+		"(alpha",
+		"alpha)",
+		"(alpha OR beta",
+		"alpha OR beta)",
+		"()",
+		"alpha AND",
+		"alpha OR",
+		"OR alpha",
+		"AND alpha",
+		"alpha AND OR beta",
+		"NOT",
+		"alpha NOT",
+		"nmae:alpha",
+		"size:big",
+		"name:",
+		"\"unterminated phrase",
+		"name:\"unterminated",
+		"\"\"",
+		"\"   \"",
+	}
+
+	for _, expression := range expressions {
+		_, err := Parse(expression)
+		if err == nil {
+			t.Errorf("expected '%s' to be rejected", expression)
+		}
+	}
+}
+
+func TestParseURLsAreNotFields(t *testing.T) {
+	q := mustParse(t, "https://data.example.com/genome")
+	matched, _ := q.Match(&dataset.Dataset{URL: "https://data.example.com/genome/v1"})
+	if !matched {
+		t.Errorf("expected a URL term to match the dataset URL")
+	}
+}
+
+func TestMatchPhrases(t *testing.T) {
+	testCases := []struct {
+		expression  string
+		description string
+		matched     bool
+	}{
+		{"\"rna seq\"", "RNA seq reads", true},
+		{"\"rna seq\"", "seq rna reads", false},
+		{"\"rna seq\"", "rna and seq", false},
+		{"\"rna   seq\"", "rna seq", true},
+		{"\"rna seq\" OR genome", "human genome", true},
+		{"description:\"rna seq\"", "RNA Seq", true},
+		{"name:\"rna seq\"", "RNA Seq", false},
+	}
+
+	for _, testCase := range testCases {
+		q := mustParse(t, testCase.expression)
+		matched, _ := q.Match(&dataset.Dataset{Description: testCase.description})
+		if matched != testCase.matched {
+			t.Errorf("'%s' on description '%s': expected %v, got %v", testCase.expression, testCase.description, testCase.matched, matched)
+		}
+	}
+}
+
+func TestMatchFields(t *testing.T) {
+	ds := &dataset.Dataset{
+		ID:          42,
+		Name:        "Maize Genome",
+		Description: "Assembly of the alpha release",
+		Creator:     "Jane Doe",
+		Host:        "CyVerse",
+		Rights:      "CC-BY",
+		URL:         "irods://data.cyverse.org/iplant/home/maize",
+		Tags: map[string]string{
+			"organism": "Zea mays",
+		},
+	}
+
+	testCases := []struct {
+		expression string
+		matched    bool
+	}{
+		{"name:maize", true},
+		{"NAME:maize", true},
+		{"name:alpha", false},
+		{"description:alpha", true},
+		{"description:maize", false},
+		{"creator:jane", true},
+		{"host:cyverse", true},
+		{"rights:cc-by", true},
+		{"url:iplant", true},
+		{"scheme:irods", true},
+		{"scheme:https", false},
+		{"tag:mays", true},
+		{"tag:organism", false},
+		{"id:42", true},
+		{"id:4", false},
+		{"42", true},
+		{"name:maize description:alpha", true},
+		{"name:maize NOT creator:jane", false},
+	}
+
+	for _, testCase := range testCases {
+		q := mustParse(t, testCase.expression)
+		matched, _ := q.Match(ds)
+		if matched != testCase.matched {
+			t.Errorf("'%s': expected %v, got %v", testCase.expression, testCase.matched, matched)
+		}
+	}
+}
+
+func TestMatchShortTerms(t *testing.T) {
+	testCases := []struct {
+		term    string
+		text    string
+		matched bool
+	}{
+		{"RNA", "RNA-seq of leaves", true},
+		{"rna", "Total RNA", true},
+		{"RNA", "mRNA expression", false},
+		{"RNA", "rnase activity", false},
+		{"GEO", "Series from GEO (accession GSE1)", true},
+		{"GEO", "(GEO)", true},
+		{"GEO", "Geography of maize", false},
+		{"GEO", "biogeochemistry", false},
+		// terms of MinSubstringLen runes match anywhere
+		{"geog", "Geography of maize", true},
+		{"seqs", "subseqs", true},
+	}
+
+	for _, testCase := range testCases {
+		q := mustParse(t, testCase.term)
+		matched, _ := q.Match(&dataset.Dataset{Description: testCase.text})
+		if matched != testCase.matched {
+			t.Errorf("'%s' on '%s': expected %v, got %v", testCase.term, testCase.text, testCase.matched, matched)
+		}
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	testCases := []struct {
+		expression string
+		keywords   []string
+	}{
+		{"genome", []string{"genome"}},
+		{"genome maize", []string{"genome", "maize"}},
+		{"genome OR maize", []string{"genome", "maize"}},
+		{"(genome OR maize) AND leaves", []string{"genome", "maize", "leaves"}},
+		{"", nil},
+		{"NOT genome", nil},
+		{"genome NOT maize", nil},
+		{"genome OR NOT maize", nil},
+		{"name:genome", nil},
+		{"genome name:maize", nil},
+		{"genome OR tag:maize", nil},
+		{"\"genome assembly\"", nil},
+		{"RNA", nil},
+		{"genome RNA", nil},
+	}
+
+	for _, testCase := range testCases {
+		keywords := mustParse(t, testCase.expression).Keywords()
+		if !reflect.DeepEqual(keywords, testCase.keywords) {
+			t.Errorf("'%s': expected %v, got %v", testCase.expression, testCase.keywords, keywords)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	inDescription := &dataset.Dataset{ID: 1, Name: "other", Description: "an alpha release"}
+	inName := &dataset.Dataset{ID: 2, Name: "alpha"}
+	twiceInDescription := &dataset.Dataset{ID: 3, Name: "other", Description: "alpha and alpha"}
+	notMatched := &dataset.Dataset{ID: 4, Name: "beta"}
+	tiedInDescription := &dataset.Dataset{ID: 5, Name: "other", Description: "alpha"}
+
+	q := mustParse(t, "alpha")
+	ranked := q.Rank([]*dataset.Dataset{inDescription, inName, twiceInDescription, notMatched, tiedInDescription})
+
+	expected := []int64{2, 3, 1, 5}
+	ids := []int64{}
+	for _, scored := range ranked {
+		ids = append(ids, scored.Dataset.ID)
+	}
+
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected ranking %v, got %v", expected, ids)
+	}
+
+	for idx := 1; idx < len(ranked); idx++ {
+		if ranked[idx].Score > ranked[idx-1].Score {
+			t.Errorf("scores are not in descending order - %v", ranked)
+		}
+	}
+
+	// an id match ranks above text matches
+	q = mustParse(t, "alpha OR 4")
+	ranked = q.Rank([]*dataset.Dataset{inDescription, notMatched})
+	if len(ranked) != 2 || ranked[0].Dataset.ID != 4 {
+		t.Errorf("expected dataset 4 first, got %v", ranked)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	testCases := []struct {
+		expression string
+		field      string
+		text       string
+		expected   string
+	}{
+		{"alpha", FieldName, "Alpha and alpha", "[Alpha] and [alpha]"},
+		{"alpha", FieldName, "no match", "no match"},
+		{"\"alpha release\"", FieldDescription, "the Alpha Release", "the [Alpha Release]"},
+		// overlapping and adjacent matches are merged
+		{"alphabet phabe", FieldName, "alphabet", "[alphabet]"},
+		{"alpha beta", FieldName, "alphabeta soup", "[alphabeta] soup"},
+		{"alpha lphab", FieldName, "alphabet", "[alphab]et"},
+		// field-scoped terms only mark their field
+		{"name:alpha", FieldName, "alpha", "[alpha]"},
+		{"name:alpha", FieldDescription, "alpha", "alpha"},
+		{"id:42", FieldName, "42", "42"},
+		// terms under NOT are not marked
+		{"beta NOT alpha", FieldName, "alpha beta", "alpha [beta]"},
+		// short terms only mark whole words
+		{"RNA", FieldDescription, "mRNA and RNA", "mRNA and [RNA]"},
+		{"données", FieldName, "Les Données", "Les [Données]"},
+		{"", FieldName, "alpha", "alpha"},
+	}
+
+	for _, testCase := range testCases {
+		q := mustParse(t, testCase.expression)
+		highlighted := q.Highlight(testCase.field, testCase.text, markBrackets)
+		if highlighted != testCase.expected {
+			t.Errorf("'%s' on %s '%s': expected '%s', got '%s'", testCase.expression, testCase.field, testCase.text, testCase.expected, highlighted)
+		}
+	}
+}
+
+func TestJoinArgs(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"alpha", "OR", "beta"}, "alpha OR beta"},
+		{[]string{"rna seq"}, "\"rna seq\""},
+		{[]string{"name:rna seq"}, "name:\"rna seq\""},
+		{[]string{"\"rna seq\""}, "\"rna seq\""},
+	}
+
+	for _, testCase := range testCases {
+		joined := JoinArgs(testCase.args)
+		if joined != testCase.expected {
+			t.Errorf("%q: expected '%s', got '%s'", testCase.args, testCase.expected, joined)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	// DefaultTimeout is a default timeout of each request
+	DefaultTimeout = 30 * time.Second
+
+	methodPropfind = "PROPFIND"
+
+	propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:">
+  <D:prop>
+    <D:resourcetype/>
+    <D:getcontentlength/>
+    <D:getlastmodified/>
+  </D:prop>
+</D:propfind>`
+)
+
+var (
+	// ErrNotWebDAV is returned when a server does not support WebDAV methods
+	ErrNotWebDAV = errors.New("not a WebDAV server")
+)
+
+// ClientOptions holds options of a WebDAV client
+type ClientOptions struct {
+	Trace   bool
+	Timeout time.Duration
+}
+
+// Client browses a WebDAV collection
+type Client struct {
+	datasetURL string
+	rootURL    *url.URL
+	restClient *resty.Client
+}
+
+// Entry is a file or a collection
+type Entry struct {
+	// Path is a path relative to the root of the client, starting with '/'
+	Path    string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+
+	// url is set for files not served by WebDAV
+	url string
+}
+
+// Name returns the last element of the path
+func (entry *Entry) Name() string {
+	return path.Base(entry.Path)
+}
+
+type multiStatus struct {
+	Responses []response `xml:"DAV: response"`
+}
+
+type response struct {
+	Href      string     `xml:"DAV: href"`
+	PropStats []propStat `xml:"DAV: propstat"`
+}
+
+type propStat struct {
+	Prop   prop   `xml:"DAV: prop"`
+	Status string `xml:"DAV: status"`
+}
+
+type prop struct {
+	ResourceType  resourceType `xml:"DAV: resourcetype"`
+	ContentLength string       `xml:"DAV: getcontentlength"`
+	LastModified  string       `xml:"DAV: getlastmodified"`
+}
+
+type resourceType struct {
+	Collection *struct{} `xml:"DAV: collection"`
+}
+
+// GetHTTPURL returns an HTTP URL of a dataset URL
+// webdav:// and davfs:// URLs are served over https
+func GetHTTPURL(datasetURL string) (*url.URL, error) {
+	u, err := url.Parse(datasetURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse URL: %v", err)
+	}
+
+	httpURL := *u
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+	case "webdav", "davfs":
+		httpURL.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("unknown scheme - %s", u.Scheme)
+	}
+	return &httpURL, nil
+}
+
+// NewClient returns a WebDAV client rooted at the dataset URL
+func NewClient(datasetURL string, options *ClientOptions) (*Client, error) {
+	if options == nil {
+		options = &ClientOptions{
+			Timeout: DefaultTimeout,
+		}
+	}
+
+	rootURL, err := GetHTTPURL(datasetURL)
+	if err != nil {
+		return nil, err
+	}
+
+	httpURL := rootURL.String()
+	if !strings.HasSuffix(rootURL.Path, "/") {
+		rootURL.Path += "/"
+	}
+
+	restClient := resty.New()
+	restClient.SetDebug(options.Trace)
+	if options.Timeout > 0 {
+		// bound connecting and waiting for responses, but not reading bodies of large files
+		restClient.SetTransport(&http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout: options.Timeout,
+			}).DialContext,
+			TLSHandshakeTimeout:   options.Timeout,
+			ResponseHeaderTimeout: options.Timeout,
+		})
+	}
+
+	return &Client{
+		datasetURL: httpURL,
+		rootURL:    rootURL,
+		restClient: restClient,
+	}, nil
+}
+
+// makeURL returns a URL of a path under the root, the path cannot go above the root
+func (client *Client) makeURL(entryPath string) string {
+	u := *client.rootURL
+	u.Path = path.Join(client.rootURL.Path, path.Clean("/"+entryPath))
+	if strings.HasSuffix(entryPath, "/") && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	u.RawPath = ""
+	return u.String()
+}
+
+// relativePath returns a path relative to the root from an href in a response
+func (client *Client) relativePath(href string) (string, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", fmt.Errorf("could not parse href %s - %v", href, err)
+	}
+
+	// clean dot segments so that an href cannot climb above the root
+	rootPath := strings.TrimSuffix(client.rootURL.Path, "/")
+	entryPath := strings.TrimSuffix(path.Clean(u.Path), "/")
+	if !strings.HasPrefix(entryPath+"/", rootPath+"/") {
+		return "", fmt.Errorf("href %s is not under %s", href, client.rootURL.Path)
+	}
+
+	relPath := strings.TrimPrefix(entryPath, rootPath)
+	if len(relPath) == 0 {
+		relPath = "/"
+	}
+	return relPath, nil
+}
+
+// Stat returns the entry at the path
+func (client *Client) Stat(ctx context.Context, entryPath string) (*Entry, error) {
+	entries, err := client.propfind(ctx, entryPath, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no properties of %s are returned", entryPath)
+	}
+	return entries[0], nil
+}
+
+// Check checks that the dataset URL responds to PROPFIND, or to HEAD if the server does not support WebDAV
+func (client *Client) Check(ctx context.Context) error {
+	_, err := client.Stat(ctx, "/")
+	if err == nil || !errors.Is(err, ErrNotWebDAV) {
+		return err
+	}
+
+	_, headErr := client.getContentLength(ctx, client.datasetURL)
+	if headErr != nil {
+		return fmt.Errorf("%w, and %v", err, headErr)
+	}
+	return nil
+}
+
+// List returns entries of the collection at the path, sorted by path
+// A file path gives the file itself
+func (client *Client) List(ctx context.Context, entryPath string) ([]*Entry, error) {
+	entries, err := client.propfind(ctx, entryPath, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	target := path.Clean("/" + entryPath)
+	children := []*Entry{}
+	for _, entry := range entries {
+		if entry.Path == target && entry.IsDir {
+			// the collection itself
+			continue
+		}
+		children = append(children, entry)
+	}
+
+	sort.Slice(children, func(i int, j int) bool {
+		return children[i].Path < children[j].Path
+	})
+	return children, nil
+}
+
+// WalkFunc is called for each entry visited by Walk, returning an error stops the walk
+type WalkFunc func(entry *Entry) error
+
+// Walk visits entries under the path, collections are listed up to maxDepth levels below the path
+// A maxDepth of 0 or less means no limit
+func (client *Client) Walk(ctx context.Context, entryPath string, maxDepth int, fn WalkFunc) error {
+	return client.walk(ctx, entryPath, 1, maxDepth, fn)
+}
+
+func (client *Client) walk(ctx context.Context, entryPath string, depth int, maxDepth int, fn WalkFunc) error {
+	entries, err := client.List(ctx, entryPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err = fn(entry)
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir && (maxDepth <= 0 || depth < maxDepth) {
+			err = client.walk(ctx, entry.Path+"/", depth+1, maxDepth, fn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (client *Client) propfind(ctx context.Context, entryPath string, depth int) ([]*Entry, error) {
+	requestURL := client.makeURL(entryPath)
+	resp, err := client.restClient.R().
+		SetContext(ctx).
+		SetHeader("Depth", strconv.Itoa(depth)).
+		SetHeader("Content-Type", "application/xml; charset=utf-8").
+		SetBody(propfindBody).
+		Execute(methodPropfind, requestURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// plain HTTP servers answer PROPFIND with various statuses, e.g. 200, 400, 403 or 405
+	switch resp.StatusCode() {
+	case http.StatusMultiStatus:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%s is not found", requestURL)
+	case http.StatusUnauthorized:
+		return nil, fmt.Errorf("PROPFIND %s failed - %s", requestURL, resp.Status())
+	default:
+		return nil, fmt.Errorf("%w - PROPFIND %s failed - %s", ErrNotWebDAV, requestURL, resp.Status())
+	}
+
+	status := multiStatus{}
+	err = xml.Unmarshal(resp.Body(), &status)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse PROPFIND response from %s - %v", requestURL, err)
+	}
+
+	entries := []*Entry{}
+	for _, r := range status.Responses {
+		entry, err := client.makeEntry(&r)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (client *Client) makeEntry(r *response) (*Entry, error) {
+	entryPath, err := client.relativePath(r.Href)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &Entry{
+		Path: entryPath,
+	}
+
+	for _, ps := range r.PropStats {
+		if !isSuccessStatus(ps.Status) {
+			continue
+		}
+
+		if ps.Prop.ResourceType.Collection != nil {
+			entry.IsDir = true
+		}
+
+		if len(ps.Prop.ContentLength) > 0 {
+			entry.Size, _ = strconv.ParseInt(strings.TrimSpace(ps.Prop.ContentLength), 10, 64)
+		}
+
+		if len(ps.Prop.LastModified) > 0 {
+			entry.ModTime, _ = http.ParseTime(strings.TrimSpace(ps.Prop.LastModified))
+		}
+	}
+	return entry, nil
+}
+
+// isSuccessStatus checks a status line, e.g. HTTP/1.1 200 OK
+func isSuccessStatus(status string) bool {
+	fields := strings.Fields(status)
+	return len(fields) >= 2 && strings.HasPrefix(fields[1], "2")
+}
@@ -0,0 +1,332 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webdav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	xwebdav "golang.org/x/net/webdav"
+)
+
+const testRootPath = "/data"
+
+var testFiles = map[string]int64{
+	"/README":              10,
+	"/a/one.txt":           1,
+	"/a/b/two.txt":         2,
+	"/a/b/c/three.txt":     3,
+	"/with space/100%.txt": 100,
+}
+
+// davServer is a local WebDAV server serving files under testRootPath
+type davServer struct {
+	*httptest.Server
+
+	mutex  sync.Mutex
+	depths []string
+}
+
+// newDAVHandler returns a WebDAV handler serving files of the given sizes under testRootPath, files are filled with 'x'
+func newDAVHandler(t *testing.T, files map[string]int64) http.Handler {
+	ctx := context.Background()
+	fs := xwebdav.NewMemFS()
+	for filePath, size := range files {
+		dirPath := ""
+		for _, dirName := range strings.Split(path.Dir(filePath), "/") {
+			if len(dirName) == 0 {
+				continue
+			}
+
+			dirPath += "/" + dirName
+			err := fs.Mkdir(ctx, dirPath, 0755)
+			if err != nil && !os.IsExist(err) {
+				t.Fatalf("could not create %s - %v", dirPath, err)
+			}
+		}
+
+		f, err := fs.OpenFile(ctx, filePath, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatalf("could not create %s - %v", filePath, err)
+		}
+		f.Write([]byte(strings.Repeat("x", int(size))))
+		f.Close()
+	}
+
+	return &xwebdav.Handler{
+		Prefix:     testRootPath,
+		FileSystem: fs,
+		LockSystem: xwebdav.NewMemLS(),
+	}
+}
+
+// newDAVServer returns a WebDAV server holding files of the given sizes
+func newDAVServer(t *testing.T, files map[string]int64) *davServer {
+	handler := newDAVHandler(t, files)
+
+	server := &davServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == methodPropfind {
+			server.mutex.Lock()
+			server.depths = append(server.depths, r.Header.Get("Depth"))
+			server.mutex.Unlock()
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	return server
+}
+
+// newMultiStatusServer returns a server answering every PROPFIND with responses of the hrefs
+func newMultiStatusServer(hrefs ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sb := strings.Builder{}
+		sb.WriteString(`<?xml version="1.0" encoding="utf-8"?><D:multistatus xmlns:D="DAV:">`)
+		for _, href := range hrefs {
+			fmt.Fprintf(&sb, `<D:response><D:href>%s</D:href><D:propstat><D:prop><D:resourcetype/><D:getcontentlength>1</D:getcontentlength></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`, href)
+		}
+		sb.WriteString(`</D:multistatus>`)
+
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(sb.String()))
+	}))
+}
+
+func newTestClient(t *testing.T, serverURL string) *Client {
+	client, err := NewClient(serverURL+testRootPath, nil)
+	if err != nil {
+		t.Fatalf("could not create a client - %v", err)
+	}
+	return client
+}
+
+func getEntryPaths(entries []*Entry) []string {
+	paths := []string{}
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	return paths
+}
+
+func TestStatUsesDepthZero(t *testing.T) {
+	server := newDAVServer(t, testFiles)
+	defer server.Close()
+
+	client := newTestClient(t, server.URL)
+
+	entry, err := client.Stat(context.Background(), "/a")
+	if err != nil {
+		t.Fatalf("could not stat - %v", err)
+	}
+
+	if entry.Path != "/a" || !entry.IsDir {
+		t.Errorf("expected collection /a, got %+v", entry)
+	}
+
+	entry, err = client.Stat(context.Background(), "/a/one.txt")
+	if err != nil {
+		t.Fatalf("could not stat - %v", err)
+	}
+
+	if entry.Path != "/a/one.txt" || entry.IsDir || entry.Size != 1 || entry.ModTime.IsZero() {
+		t.Errorf("expected file /a/one.txt of 1 byte, got %+v", entry)
+	}
+
+	if !reflect.DeepEqual(server.depths, []string{"0", "0"}) {
+		t.Errorf("expected Depth 0 requests, got %v", server.depths)
+	}
+
+	_, err = client.Stat(context.Background(), "/missing")
+	if err == nil {
+		t.Errorf("expected a missing path to fail")
+	}
+}
+
+func TestListUsesDepthOne(t *testing.T) {
+	server := newDAVServer(t, testFiles)
+	defer server.Close()
+
+	client := newTestClient(t, server.URL)
+
+	entries, err := client.List(context.Background(), "/")
+	if err != nil {
+		t.Fatalf("could not list - %v", err)
+	}
+
+	expected := []string{"/README", "/a", "/with space"}
+	if paths := getEntryPaths(entries); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+
+	if !reflect.DeepEqual(server.depths, []string{"1"}) {
+		t.Errorf("expected a Depth 1 request, got %v", server.depths)
+	}
+
+	entries, err = client.List(context.Background(), "/README")
+	if err != nil {
+		t.Fatalf("could not list - %v", err)
+	}
+
+	if paths := getEntryPaths(entries); !reflect.DeepEqual(paths, []string{"/README"}) {
+		t.Errorf("expected a file to list itself, got %v", paths)
+	}
+}
+
+func TestListDecodesHrefs(t *testing.T) {
+	server := newDAVServer(t, testFiles)
+	defer server.Close()
+
+	client := newTestClient(t, server.URL)
+
+	entries, err := client.List(context.Background(), "/with space/")
+	if err != nil {
+		t.Fatalf("could not list - %v", err)
+	}
+
+	expected := []string{"/with space/100%.txt"}
+	if paths := getEntryPaths(entries); !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("expected %v, got %v", expected, paths)
+	}
+
+	if entries[0].Name() != "100%.txt" || entries[0].Size != 100 {
+		t.Errorf("expected 100%%.txt of 100 bytes, got %+v", entries[0])
+	}
+}
+
+func TestWalkMaxDepth(t *testing.T) {
+	server := newDAVServer(t, testFiles)
+	defer server.Close()
+
+	client := newTestClient(t, server.URL)
+
+	testCases := []struct {
+		maxDepth int
+		expected []string
+	}{
+		{1, []string{"/README", "/a", "/with space"}},
+		{2, []string{"/README", "/a", "/a/b", "/a/one.txt", "/with space", "/with space/100%.txt"}},
+		{0, []string{"/README", "/a", "/a/b", "/a/b/c", "/a/b/c/three.txt", "/a/b/two.txt", "/a/one.txt", "/with space", "/with space/100%.txt"}},
+	}
+
+	for _, testCase := range testCases {
+		paths := []string{}
+		err := client.Walk(context.Background(), "/", testCase.maxDepth, func(entry *Entry) error {
+			paths = append(paths, entry.Path)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("could not walk with max depth %d - %v", testCase.maxDepth, err)
+		}
+
+		if !reflect.DeepEqual(paths, testCase.expected) {
+			t.Errorf("max depth %d: expected %v, got %v", testCase.maxDepth, testCase.expected, paths)
+		}
+	}
+}
+
+func TestCheckWebDAV(t *testing.T) {
+	server := newDAVServer(t, testFiles)
+	defer server.Close()
+
+	client := newTestClient(t, server.URL)
+
+	err := client.Check(context.Background())
+	if err != nil {
+		t.Errorf("expected a WebDAV server to pass, got %v", err)
+	}
+}
+
+func TestCheckNotWebDAV(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server.URL)
+
+	err := client.Check(context.Background())
+	if !errors.Is(err, ErrNotWebDAV) {
+		t.Errorf("expected ErrNotWebDAV, got %v", err)
+	}
+}
+
+func TestCheckPlainHTTP(t *testing.T) {
+	testCases := []struct {
+		propfindStatus int
+		notWebDAV      bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusBadRequest, true},
+		{http.StatusForbidden, true},
+		{http.StatusMethodNotAllowed, true},
+		{http.StatusNotImplemented, true},
+		{http.StatusNotFound, false},
+		{http.StatusUnauthorized, false},
+	}
+
+	for _, testCase := range testCases {
+		propfindStatus := testCase.propfindStatus
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodHead {
+				w.WriteHeader(propfindStatus)
+				return
+			}
+			w.Header().Set("Content-Length", "5")
+		}))
+
+		client := newTestClient(t, server.URL)
+
+		_, err := client.Stat(context.Background(), "/")
+		if errors.Is(err, ErrNotWebDAV) != testCase.notWebDAV {
+			t.Errorf("PROPFIND status %d: expected ErrNotWebDAV %v, got %v", propfindStatus, testCase.notWebDAV, err)
+		}
+
+		err = client.Check(context.Background())
+		if testCase.notWebDAV && err != nil {
+			t.Errorf("PROPFIND status %d: expected a plain HTTP file to pass, got %v", propfindStatus, err)
+		}
+
+		if !testCase.notWebDAV && err == nil {
+			t.Errorf("PROPFIND status %d: expected the check to fail", propfindStatus)
+		}
+		server.Close()
+	}
+}
+
+func TestListRejectsHrefsOutsideRoot(t *testing.T) {
+	hrefs := []string{
+		"/other/file",
+		"/database/file",
+		"http://elsewhere.example.com/other/file",
+	}
+
+	for _, href := range hrefs {
+		server := newMultiStatusServer(href)
+		client := newTestClient(t, server.URL)
+
+		_, err := client.List(context.Background(), "/")
+		if err == nil {
+			t.Errorf("expected href %s to be rejected", href)
+		}
+		server.Close()
+	}
+}
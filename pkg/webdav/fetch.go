@@ -0,0 +1,339 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webdav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	// DefaultFetchWorkers is a default number of files downloaded concurrently
+	DefaultFetchWorkers = 4
+
+	partialFileSuffix = ".part"
+	copyBufferSize    = 64 * 1024
+)
+
+// FetchOptions holds options of Fetch
+type FetchOptions struct {
+	// Workers is the number of files downloaded concurrently
+	Workers int
+}
+
+// FetchProgress counts files and bytes of a fetch, fields are updated atomically
+type FetchProgress struct {
+	TotalFiles   int64
+	DoneFiles    int64
+	SkippedFiles int64
+	FailedFiles  int64
+	TotalBytes   int64
+	DoneBytes    int64
+}
+
+// Snapshot returns a copy of the progress that is safe to read
+func (progress *FetchProgress) Snapshot() FetchProgress {
+	return FetchProgress{
+		TotalFiles:   atomic.LoadInt64(&progress.TotalFiles),
+		DoneFiles:    atomic.LoadInt64(&progress.DoneFiles),
+		SkippedFiles: atomic.LoadInt64(&progress.SkippedFiles),
+		FailedFiles:  atomic.LoadInt64(&progress.FailedFiles),
+		TotalBytes:   atomic.LoadInt64(&progress.TotalBytes),
+		DoneBytes:    atomic.LoadInt64(&progress.DoneBytes),
+	}
+}
+
+// progressWriter counts written bytes
+type progressWriter struct {
+	writer   io.Writer
+	progress *FetchProgress
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	atomic.AddInt64(&w.progress.DoneBytes, int64(n))
+	return n, err
+}
+
+// Fetch downloads files under the path into a local directory
+// Files are downloaded concurrently, complete files are skipped and partial files are resumed with HTTP Range.
+// If the server does not support WebDAV, the root URL is downloaded as a single file.
+func (client *Client) Fetch(ctx context.Context, entryPath string, localDir string, options *FetchOptions, progress *FetchProgress) error {
+	if options == nil {
+		options = &FetchOptions{}
+	}
+
+	workers := options.Workers
+	if workers <= 0 {
+		workers = DefaultFetchWorkers
+	}
+
+	if progress == nil {
+		progress = &FetchProgress{}
+	}
+
+	files, err := client.Collect(ctx, entryPath)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		atomic.AddInt64(&progress.TotalFiles, 1)
+		if file.Size > 0 {
+			atomic.AddInt64(&progress.TotalBytes, file.Size)
+		}
+	}
+
+	fileChan := make(chan *Entry)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for file := range fileChan {
+				localPath, err := makeLocalPath(localDir, file.Path)
+				if err == nil {
+					err = client.download(ctx, file, localPath, progress)
+				}
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("Could not fetch %s - %v", file.Path, err)
+					}
+					atomic.AddInt64(&progress.FailedFiles, 1)
+					continue
+				}
+				atomic.AddInt64(&progress.DoneFiles, 1)
+			}
+		}()
+	}
+
+	for _, file := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		fileChan <- file
+	}
+	close(fileChan)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	failed := atomic.LoadInt64(&progress.FailedFiles)
+	if failed > 0 {
+		return fmt.Errorf("could not fetch %d of %d files", failed, len(files))
+	}
+	return nil
+}
+
+// makeLocalPath returns a path of the entry under the local directory, the path cannot go above the directory
+func makeLocalPath(localDir string, entryPath string) (string, error) {
+	localPath := filepath.Join(localDir, filepath.FromSlash(entryPath))
+	rel, err := filepath.Rel(localDir, localPath)
+	if err != nil {
+		return "", fmt.Errorf("could not make a local path of %s - %v", entryPath, err)
+	}
+
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not under %s", entryPath, localDir)
+	}
+	return localPath, nil
+}
+
+// Collect returns files under the path, or the path itself if it is a file
+// If the server does not support WebDAV, the root URL is returned as a single file.
+func (client *Client) Collect(ctx context.Context, entryPath string) ([]*Entry, error) {
+	files := []*Entry{}
+
+	entry, err := client.Stat(ctx, entryPath)
+	if err != nil {
+		if !errors.Is(err, ErrNotWebDAV) {
+			return nil, err
+		}
+
+		// a plain HTTP file, the dataset URL is the file
+		size, err := client.getContentLength(ctx, client.datasetURL)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, &Entry{
+			Path: path.Clean("/" + path.Base(client.rootURL.Path)),
+			Size: size,
+			url:  client.datasetURL,
+		})
+		return files, nil
+	}
+
+	if !entry.IsDir {
+		files = append(files, entry)
+		return files, nil
+	}
+
+	err = client.Walk(ctx, entryPath, 0, func(entry *Entry) error {
+		if !entry.IsDir {
+			files = append(files, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// getContentLength returns a size of the file at the URL, or -1 if unknown
+func (client *Client) getContentLength(ctx context.Context, requestURL string) (int64, error) {
+	resp, err := client.restClient.R().SetContext(ctx).Head(requestURL)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.IsError() {
+		return 0, fmt.Errorf("HEAD %s failed - %s", requestURL, resp.Status())
+	}
+	return resp.RawResponse.ContentLength, nil
+}
+
+// download downloads a file into a partial file, and renames it when complete
+func (client *Client) download(ctx context.Context, file *Entry, localPath string, progress *FetchProgress) error {
+	stat, err := os.Stat(localPath)
+	if err == nil && file.Size >= 0 && stat.Size() == file.Size {
+		atomic.AddInt64(&progress.SkippedFiles, 1)
+		atomic.AddInt64(&progress.DoneBytes, file.Size)
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(localPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	partialPath := localPath + partialFileSuffix
+	offset := int64(0)
+	if stat, err := os.Stat(partialPath); err == nil {
+		offset = stat.Size()
+	}
+
+	if file.Size >= 0 && offset > file.Size {
+		// the remote file has changed
+		offset = 0
+	}
+
+	requestURL := file.url
+	if len(requestURL) == 0 {
+		requestURL = client.makeURL(file.Path)
+	}
+
+	resp, err := client.get(ctx, requestURL, offset)
+	if err == nil && offset > 0 && resp.StatusCode() == http.StatusPartialContent && !isRangeFrom(resp, offset) {
+		// a range other than the requested one cannot be appended, the file is downloaded again
+		resp.RawBody().Close()
+		offset = 0
+		resp, err = client.get(ctx, requestURL, 0)
+	}
+	if err != nil {
+		return err
+	}
+
+	body := resp.RawBody()
+	defer body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode() {
+	case http.StatusPartialContent:
+		if !isRangeFrom(resp, offset) {
+			return fmt.Errorf("GET %s returned range '%s', not from byte %d", requestURL, resp.Header().Get("Content-Range"), offset)
+		}
+
+		if offset == 0 {
+			flags |= os.O_TRUNC
+		} else {
+			flags |= os.O_APPEND
+			atomic.AddInt64(&progress.DoneBytes, offset)
+		}
+	case http.StatusOK:
+		// the server ignored the range
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		if file.Size >= 0 && offset == file.Size {
+			atomic.AddInt64(&progress.DoneBytes, offset)
+			return os.Rename(partialPath, localPath)
+		}
+		return fmt.Errorf("GET %s failed - %s", requestURL, resp.Status())
+	default:
+		return fmt.Errorf("GET %s failed - %s", requestURL, resp.Status())
+	}
+
+	localFile, err := os.OpenFile(partialPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := &progressWriter{
+		writer:   localFile,
+		progress: progress,
+	}
+
+	_, err = io.CopyBuffer(writer, body, make([]byte, copyBufferSize))
+	closeErr := localFile.Close()
+	if err != nil {
+		return err
+	}
+
+	if closeErr != nil {
+		return closeErr
+	}
+	return os.Rename(partialPath, localPath)
+}
+
+// get requests the file at the URL from the offset, the body is not read
+func (client *Client) get(ctx context.Context, requestURL string, offset int64) (*resty.Response, error) {
+	request := client.restClient.R().SetContext(ctx).SetDoNotParseResponse(true)
+	if offset > 0 {
+		request.SetHeader("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	return request.Get(requestURL)
+}
+
+// isRangeFrom checks that Content-Range of a partial response starts at the offset, e.g. bytes 100-199/200
+func isRangeFrom(resp *resty.Response, offset int64) bool {
+	contentRange := strings.TrimSpace(resp.Header().Get("Content-Range"))
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return false
+	}
+
+	idx := strings.Index(contentRange, "-")
+	if idx < 0 {
+		return false
+	}
+
+	start, err := strconv.ParseInt(strings.TrimSpace(contentRange[len("bytes "):idx]), 10, 64)
+	return err == nil && start == offset
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2020 CyVerse
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var maliciousHrefs = []string{
+	"/data/../escaped.txt",
+	"/data/a/../../escaped.txt",
+	"/data/%2e%2e/escaped.txt",
+	"/data/..%2fescaped.txt",
+	"/data/..",
+}
+
+func TestListRejectsMaliciousHrefs(t *testing.T) {
+	for _, href := range maliciousHrefs {
+		server := newMultiStatusServer(href)
+		client := newTestClient(t, server.URL)
+
+		entries, err := client.List(context.Background(), "/")
+		if err == nil {
+			t.Errorf("expected href %s to be rejected, got %v", href, getEntryPaths(entries))
+		}
+		server.Close()
+	}
+}
+
+func TestFetchDoesNotWriteOutsideLocalDir(t *testing.T) {
+	for _, href := range maliciousHrefs {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusMultiStatus)
+			if r.Header.Get("Depth") == "0" {
+				fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><D:multistatus xmlns:D="DAV:"><D:response><D:href>/data/</D:href><D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response></D:multistatus>`)
+				return
+			}
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><D:multistatus xmlns:D="DAV:"><D:response><D:href>%s</D:href><D:propstat><D:prop><D:resourcetype/><D:getcontentlength>1</D:getcontentlength></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response></D:multistatus>`, href)
+		}))
+
+		parentDir, err := ioutil.TempDir("", "parcel-fetch-")
+		if err != nil {
+			t.Fatalf("could not create a temp dir - %v", err)
+		}
+
+		localDir := filepath.Join(parentDir, "local")
+		client := newTestClient(t, server.URL)
+
+		err = client.Fetch(context.Background(), "/", localDir, nil, nil)
+		if err == nil {
+			t.Errorf("expected fetching href %s to fail", href)
+		}
+
+		for _, name := range []string{"escaped.txt", "escaped.txt" + partialFileSuffix} {
+			if _, err := os.Stat(filepath.Join(parentDir, name)); err == nil {
+				t.Errorf("href %s wrote %s outside %s", href, name, localDir)
+			}
+		}
+
+		server.Close()
+		os.RemoveAll(parentDir)
+	}
+}
+
+func TestMakeLocalPath(t *testing.T) {
+	localDir := filepath.Join("tmp", "local")
+
+	testCases := []struct {
+		entryPath string
+		valid     bool
+	}{
+		{"/file.txt", true},
+		{"/a/b/file.txt", true},
+		{"/..file.txt", true},
+		{"/../file.txt", false},
+		{"/a/../../file.txt", false},
+		{"..", false},
+	}
+
+	for _, testCase := range testCases {
+		_, err := makeLocalPath(localDir, testCase.entryPath)
+		if testCase.valid && err != nil {
+			t.Errorf("expected %s to be valid, got %v", testCase.entryPath, err)
+		}
+
+		if !testCase.valid && err == nil {
+			t.Errorf("expected %s to be rejected", testCase.entryPath)
+		}
+	}
+}
+
+func TestFetchResumesPartialFiles(t *testing.T) {
+	server := newDAVServer(t, map[string]int64{"/file.txt": 10})
+	defer server.Close()
+
+	localDir, err := ioutil.TempDir("", "parcel-fetch-")
+	if err != nil {
+		t.Fatalf("could not create a temp dir - %v", err)
+	}
+	defer os.RemoveAll(localDir)
+
+	err = ioutil.WriteFile(filepath.Join(localDir, "file.txt"+partialFileSuffix), []byte("xxxx"), 0644)
+	if err != nil {
+		t.Fatalf("could not write a partial file - %v", err)
+	}
+
+	client := newTestClient(t, server.URL)
+	progress := &FetchProgress{}
+	err = client.Fetch(context.Background(), "/", localDir, nil, progress)
+	if err != nil {
+		t.Fatalf("could not fetch - %v", err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(localDir, "file.txt"))
+	if err != nil || string(content) != strings.Repeat("x", 10) {
+		t.Errorf("expected 10 bytes of x, got '%s' (%v)", content, err)
+	}
+
+	if progress.DoneBytes != 10 {
+		t.Errorf("expected 10 bytes done, got %d", progress.DoneBytes)
+	}
+}
+
+func TestFetchRestartsOnMismatchedRange(t *testing.T) {
+	testCases := []string{
+		// the whole file as a range
+		"bytes 0-9/10",
+		// a range after the requested one
+		"bytes 6-9/10",
+		"invalid",
+	}
+
+	for _, contentRange := range testCases {
+		handler := newDAVHandler(t, map[string]int64{"/file.txt": 10})
+		ranges := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && len(r.Header.Get("Range")) > 0 {
+				// a server or proxy answering with a range other than the requested one
+				ranges++
+				w.Header().Set("Content-Range", contentRange)
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte(strings.Repeat("x", 10)))
+				return
+			}
+			handler.ServeHTTP(w, r)
+		}))
+
+		localDir, err := ioutil.TempDir("", "parcel-fetch-")
+		if err != nil {
+			t.Fatalf("could not create a temp dir - %v", err)
+		}
+
+		// a partial file of other content shows whether it is appended to
+		err = ioutil.WriteFile(filepath.Join(localDir, "file.txt"+partialFileSuffix), []byte("yyyy"), 0644)
+		if err != nil {
+			t.Fatalf("could not write a partial file - %v", err)
+		}
+
+		client := newTestClient(t, server.URL)
+		err = client.Fetch(context.Background(), "/", localDir, nil, nil)
+		if err != nil {
+			t.Errorf("range '%s': could not fetch - %v", contentRange, err)
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(localDir, "file.txt"))
+		if err != nil || string(content) != strings.Repeat("x", 10) {
+			t.Errorf("range '%s': expected 10 bytes of x, got '%s' (%v)", contentRange, content, err)
+		}
+
+		if ranges != 1 {
+			t.Errorf("range '%s': expected one range request, got %d", contentRange, ranges)
+		}
+
+		server.Close()
+		os.RemoveAll(localDir)
+	}
+}